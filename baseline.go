@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const baselineVersion = 1
+
+// baseline is a set of known diagnostics. Only diagnostics not in the baseline are reported.
+type baseline struct {
+	Version int              `json:"version"`
+	Entries []*baselineEntry `json:"entries"`
+}
+
+// baselineEntry identifies a diagnostic independently of its line, so that unrelated changes of the file do not turn
+// known diagnostics into new ones.
+type baselineEntry struct {
+	baselineKey
+	// Message is the first message of the diagnostics with the key, for humans only.
+	Message string `json:"message"`
+	// Count is the number of diagnostics with the key, e.g. the same statement repeated in a function.
+	Count int `json:"count"`
+}
+
+type baselineKey struct {
+	Package string `json:"package"`
+	// Func is the enclosing function, e.g. "(*Cache).Get", empty for diagnostics outside of functions.
+	Func string `json:"func"`
+	// Field is the field the diagnostic is reported for, if any.
+	Field string `json:"field"`
+	// Fingerprint is a hash of the normalised statement and message of the diagnostic.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// filterBaseline returns the diagnostics that are not in the baseline file.
+func filterBaseline(path string, res *result) ([]diagnostic, error) {
+	known, err := readBaseline(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDiagnostics(res, baselineKeys(res), known), nil
+}
+
+func baselineKeys(res *result) []baselineKey {
+	keys := make([]baselineKey, len(res.diagnostics))
+	for i, d := range res.diagnostics {
+		keys[i] = newBaselineKey(res.fset, d)
+	}
+
+	return keys
+}
+
+// newDiagnostics returns the diagnostics that are not known. A key known n times covers n diagnostics.
+func newDiagnostics(res *result, keys []baselineKey, known map[baselineKey]int) []diagnostic {
+	var diags []diagnostic
+	for i, d := range res.diagnostics {
+		if known[keys[i]] > 0 {
+			known[keys[i]]--
+			continue
+		}
+		diags = append(diags, d)
+	}
+
+	return diags
+}
+
+// readBaseline returns the number of known diagnostics by key.
+func readBaseline(path string) (map[baselineKey]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var b baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("parse baseline %s: %w", path, err)
+	}
+	if b.Version != baselineVersion {
+		return nil, fmt.Errorf("unsupported baseline version %d in %s, regenerate it with -write-baseline",
+			b.Version, path)
+	}
+
+	res := make(map[baselineKey]int, len(b.Entries))
+	for _, e := range b.Entries {
+		res[e.baselineKey] += e.Count
+	}
+
+	return res, nil
+}
+
+func writeBaseline(path string, res *result, keys []baselineKey) error {
+	b := baseline{Version: baselineVersion}
+	entries := make(map[baselineKey]*baselineEntry)
+	for i, d := range res.diagnostics {
+		if e, ok := entries[keys[i]]; ok {
+			e.Count++
+			continue
+		}
+		entries[keys[i]] = &baselineEntry{baselineKey: keys[i], Message: d.Message, Count: 1}
+		b.Entries = append(b.Entries, entries[keys[i]])
+	}
+	slices.SortFunc(b.Entries, func(x, y *baselineEntry) int {
+		return cmp.Or(
+			cmp.Compare(x.Package, y.Package),
+			cmp.Compare(x.Func, y.Func),
+			cmp.Compare(x.Field, y.Field),
+			cmp.Compare(x.Fingerprint, y.Fingerprint),
+		)
+	})
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// numbers are replaced in messages, e.g. line numbers, so that the fingerprint does not depend on them.
+var numbers = regexp.MustCompile(`[0-9]+`)
+
+func newBaselineKey(fset *token.FileSet, d diagnostic) baselineKey {
+	key := baselineKey{Package: d.pkg.PkgPath}
+
+	var file *ast.File
+	for _, f := range d.pkg.Syntax {
+		if f.FileStart <= d.Pos && d.Pos <= f.FileEnd {
+			file = f
+			break
+		}
+	}
+
+	var stmt string
+	if file != nil {
+		path, _ := astutil.PathEnclosingInterval(file, d.Pos, d.Pos)
+		key.Func = funcName(path)
+		key.Field = fieldName(path)
+		stmt = statementText(fset, path)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(stmt))
+	h.Write([]byte{0})
+	h.Write([]byte(numbers.ReplaceAllString(d.Message, "N")))
+	key.Fingerprint = hex.EncodeToString(h.Sum(nil))[:16]
+
+	return key
+}
+
+// funcName returns the name of the function enclosing the path, e.g. "(*Cache).Get".
+func funcName(path []ast.Node) string {
+	for _, n := range path {
+		fn, ok := n.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if fn.Recv == nil || len(fn.Recv.List) == 0 {
+			return fn.Name.Name
+		}
+
+		ptr := ""
+		for recv := fn.Recv.List[0].Type; ; {
+			switch t := recv.(type) {
+			case *ast.StarExpr:
+				ptr, recv = "*", t.X
+			case *ast.ParenExpr:
+				recv = t.X
+			case *ast.IndexExpr:
+				recv = t.X
+			case *ast.IndexListExpr:
+				recv = t.X
+			case *ast.Ident:
+				return fmt.Sprintf("(%s%s).%s", ptr, t.Name, fn.Name.Name)
+			default:
+				return fn.Name.Name
+			}
+		}
+	}
+
+	return ""
+}
+
+// fieldName returns the name of the selected field or of the declared field the path starts in.
+func fieldName(path []ast.Node) string {
+	for _, n := range path {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			return n.Sel.Name
+		case *ast.Field:
+			if len(n.Names) > 0 {
+				return n.Names[0].Name
+			}
+			return ""
+		case ast.Stmt, ast.Decl:
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// statementText returns the source of the innermost simple statement on the path with whitespace normalised. A
+// compound statement, e.g. an if statement, is represented by its part on the path, e.g. the condition, so that
+// changes in its body do not change the text.
+func statementText(fset *token.FileSet, path []ast.Node) string {
+	var node ast.Node
+	for i, n := range path {
+		if isCompound(n) {
+			if i > 0 {
+				node = path[i-1]
+			}
+			break
+		}
+		if _, ok := n.(ast.Stmt); ok {
+			node = n
+			break
+		}
+		if _, ok := n.(*ast.Field); ok {
+			node = n
+			break
+		}
+	}
+	if node == nil {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func isCompound(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.BlockStmt, *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt,
+		*ast.SelectStmt, *ast.CaseClause, *ast.CommClause, *ast.LabeledStmt, *ast.FuncDecl, *ast.FuncLit,
+		*ast.GenDecl, *ast.File:
+		return true
+	}
+
+	return false
+}
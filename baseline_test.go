@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mneverov/protectedby/protectedby"
+)
+
+const baselineSrc = `package bl
+
+import "sync"
+
+type s struct {
+	// i is protected by mu.
+	i  int
+	mu sync.Mutex
+}
+
+func (s *s) inc() {
+	s.i++
+}
+
+func (s *s) dec() {
+	s.i--
+	s.i--
+}
+`
+
+func TestBaseline(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "go.mod", "module example.com/bl\n\ngo 1.22\n")
+	writeFile(t, "bl.go", baselineSrc)
+	path := filepath.Join(dir, "baseline.json")
+
+	res := analyzeModule(t)
+	if len(res.diagnostics) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %d", len(res.diagnostics))
+	}
+	if err := writeBaseline(path, res, baselineKeys(res)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines shift and a new statement appears in one of the functions, only the latter is new.
+	src := strings.Replace(baselineSrc, "func (s *s) inc() {\n", "// inc increments i.\nfunc (s *s) inc() {\n", 1)
+	src = strings.Replace(src, "\ts.i--\n\ts.i--\n", "\ts.i--\n\ts.i--\n\ts.i = 0\n", 1)
+	writeFile(t, "bl.go", src)
+
+	res = analyzeModule(t)
+	known, err := readBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags := newDiagnostics(res, baselineKeys(res), known)
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 new diagnostic, got %d", len(diags))
+	}
+	if pos := res.fset.Position(diags[0].Pos); pos.Line != 19 {
+		t.Fatalf("expected new diagnostic at line 19, got %s", pos)
+	}
+}
+
+func analyzeModule(t *testing.T) *result {
+	t.Helper()
+
+	res, err := analyze(protectedby.Analyzer, false, []string{"./..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"go/token"
+	"os"
+	"slices"
+
+	"github.com/mneverov/protectedby/protectedby"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/packages"
+)
+
+// diagnostic is a diagnostic together with the package it is reported in.
+type diagnostic struct {
+	analysis.Diagnostic
+	pkg *packages.Package
+}
+
+// result is the result of the analysis of the packages matching the command line patterns.
+type result struct {
+	fset        *token.FileSet
+	pkgs        []*packages.Package
+	diagnostics []diagnostic
+	// coverage is the annotation coverage by package path. Of a package and its test variant, the variant with more
+	// files is kept.
+	coverage map[string]packageCoverage
+}
+
+type packageCoverage struct {
+	*protectedby.Coverage
+	pkg *packages.Package
+}
+
+// newFlagSet returns a flag set of a command mode with the analyzer flags and the -test flag of singlechecker.
+func newFlagSet(name string, a *analysis.Analyzer, tests *bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	a.Flags.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	fs.BoolVar(tests, "test", true, "indicates whether test files should be analyzed, too")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags] [packages]\n\nFlags:\n", name)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// analyze runs the analyzer over the packages matching the patterns.
+func analyze(a *analysis.Analyzer, tests bool, patterns []string) (*result, error) {
+	cfg := &packages.Config{
+		Mode:  packages.LoadAllSyntax,
+		Tests: tests,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return nil, fmt.Errorf("failed to load packages")
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no packages match %v", patterns)
+	}
+
+	graph, err := checker.Analyze([]*analysis.Analyzer{a}, pkgs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &result{fset: pkgs[0].Fset, pkgs: pkgs, coverage: make(map[string]packageCoverage)}
+	// A package and its test variant share files, report a diagnostic once.
+	seen := make(map[string]bool)
+	for act := range graph.All() {
+		if !act.IsRoot || act.Analyzer != a {
+			continue
+		}
+		if act.Err != nil {
+			return nil, act.Err
+		}
+		if c, ok := act.Result.(*protectedby.Coverage); ok {
+			path := act.Package.PkgPath
+			if prev, ok := res.coverage[path]; !ok || len(prev.pkg.Syntax) < len(act.Package.Syntax) {
+				res.coverage[path] = packageCoverage{Coverage: c, pkg: act.Package}
+			}
+		}
+		for _, d := range act.Diagnostics {
+			key := fmt.Sprintf("%s: %s", res.fset.Position(d.Pos), d.Message)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			res.diagnostics = append(res.diagnostics, diagnostic{Diagnostic: d, pkg: act.Package})
+		}
+	}
+	slices.SortFunc(res.diagnostics, func(a, b diagnostic) int {
+		pa, pb := res.fset.Position(a.Pos), res.fset.Position(b.Pos)
+		return cmp.Or(cmp.Compare(pa.Filename, pb.Filename), cmp.Compare(pa.Offset, pb.Offset))
+	})
+
+	return res, nil
+}
+
+// printDiagnostics prints the diagnostics the same way singlechecker does. Diagnostics of other levels than errors are
+// prefixed with the level.
+func printDiagnostics(fset *token.FileSet, diags []diagnostic, sev protectedby.Severity) {
+	for _, d := range diags {
+		if l := sev.Level(d.Category); l != protectedby.LevelError {
+			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", fset.Position(d.Pos), l, d.Message)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fset.Position(d.Pos), d.Message)
+	}
+}
@@ -1,10 +1,129 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"strings"
+
 	"github.com/mneverov/protectedby/protectedby"
 	"golang.org/x/tools/go/analysis/singlechecker"
 )
 
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "report" {
+		os.Exit(reportMain(args[1:]))
+	}
+	if hasFlag(args, "baseline") || hasFlag(args, "sarif") || hasFlag(args, "severity") {
+		os.Exit(driverMain(args))
+	}
+
 	singlechecker.Main(protectedby.Analyzer)
 }
+
+// driverMain runs the analyzer in the modes singlechecker does not support:
+//   - -baseline=path reports only diagnostics that are not in the baseline file, together with -write-baseline it
+//     writes all diagnostics to the file instead;
+//   - -sarif writes diagnostics to the standard output in the SARIF format;
+//   - -severity sets the level of diagnostics by category, only errors fail the run.
+func driverMain(args []string) int {
+	var (
+		tests     bool
+		path      string
+		write     bool
+		sarifMode bool
+	)
+	fs := newFlagSet("protectedby", protectedby.Analyzer, &tests)
+	fs.StringVar(&path, "baseline", "", "report only diagnostics that are not in the baseline file")
+	fs.BoolVar(&write, "write-baseline", false, "write all diagnostics to the baseline file")
+	fs.BoolVar(&sarifMode, "sarif", false, "write diagnostics to the standard output in the SARIF 2.1.0 format")
+	_ = fs.Parse(args)
+	if write && path == "" {
+		fmt.Fprintln(os.Stderr, "protectedby: -write-baseline requires -baseline=path")
+		return 1
+	}
+
+	res, err := analyze(protectedby.Analyzer, tests, fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "protectedby: %v\n", err)
+		return 1
+	}
+
+	diags := res.diagnostics
+	sev := protectedby.SeverityOf(protectedby.Analyzer)
+	if path != "" {
+		if write {
+			err = writeBaseline(path, res, baselineKeys(res))
+		} else {
+			diags, err = filterBaseline(path, res)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "protectedby: %v\n", err)
+			return 1
+		}
+		if write {
+			return 0
+		}
+	}
+
+	if sarifMode {
+		if err := writeSARIF(os.Stdout, workingDir(), res.fset, diags, sev); err != nil {
+			fmt.Fprintf(os.Stderr, "protectedby: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	printDiagnostics(res.fset, diags, sev)
+	for _, d := range diags {
+		if sev.Level(d.Category) == protectedby.LevelError {
+			return 3
+		}
+	}
+
+	return 0
+}
+
+// reportMain prints the annotation coverage of the packages instead of diagnostics: the structs with a sync.Locker
+// field, their annotated and not annotated fields, the number of checked accesses per field and the suppressed
+// annotations.
+func reportMain(args []string) int {
+	var (
+		tests  bool
+		format string
+	)
+	fs := newFlagSet("protectedby report", protectedby.Analyzer, &tests)
+	fs.StringVar(&format, "format", formatText, "report format: text, csv or json")
+	_ = fs.Parse(args)
+	if err := checkReportFormat(format); err != nil {
+		fmt.Fprintf(os.Stderr, "protectedby: %v\n", err)
+		return 1
+	}
+
+	res, err := analyze(protectedby.Analyzer, tests, fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "protectedby: %v\n", err)
+		return 1
+	}
+	if err := writeReport(os.Stdout, format, newReport(res, workingDir())); err != nil {
+		fmt.Fprintf(os.Stderr, "protectedby: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// hasFlag reports whether the command line arguments before the first package pattern contain the flag.
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return false
+		}
+		arg = strings.TrimLeft(arg, "-")
+		if n, _, _ := strings.Cut(arg, "="); n == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,37 @@
+// Package plugin registers protectedby as a golangci-lint module plugin. The plugin settings are decoded into
+// protectedby.Config, see its json names.
+package plugin
+
+import (
+	"github.com/golangci/plugin-module-register/register"
+	"github.com/mneverov/protectedby/protectedby"
+	"golang.org/x/tools/go/analysis"
+)
+
+func init() {
+	register.Plugin("protectedby", New)
+}
+
+type plugin struct {
+	cfg protectedby.Config
+}
+
+var _ register.LinterPlugin = (*plugin)(nil)
+
+// New returns the plugin configured with the golangci-lint settings.
+func New(settings any) (register.LinterPlugin, error) {
+	cfg, err := register.DecodeSettings[protectedby.Config](settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &plugin{cfg: cfg}, nil
+}
+
+func (p *plugin) BuildAnalyzers() ([]*analysis.Analyzer, error) {
+	return []*analysis.Analyzer{protectedby.NewAnalyzer(p.cfg)}, nil
+}
+
+func (p *plugin) GetLoadMode() string {
+	return register.LoadModeTypesInfo
+}
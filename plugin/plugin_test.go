@@ -0,0 +1,40 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/golangci/plugin-module-register/register"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestPlugin(t *testing.T) {
+	newPlugin, err := register.GetPlugin("protectedby")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Settings as golangci-lint passes them after parsing .golangci.yml.
+	p, err := newPlugin(map[string]any{
+		"protected-by":   []any{"guarded by"},
+		"allow-exported": true,
+		"suppress":       []any{"settings.s.ignored"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := p.GetLoadMode(); mode != register.LoadModeTypesInfo {
+		t.Fatalf("expected load mode %q, got %q", register.LoadModeTypesInfo, mode)
+	}
+
+	analyzers, err := p.BuildAnalyzers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysistest.Run(t, analysistest.TestData(), analyzers[0], "settings")
+}
+
+func TestPluginUnknownSetting(t *testing.T) {
+	if _, err := New(map[string]any{"protected_by": []any{"guarded by"}}); err == nil {
+		t.Fatal("expected error for unknown setting")
+	}
+}
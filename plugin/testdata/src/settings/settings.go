@@ -0,0 +1,30 @@
+package settings
+
+import "sync"
+
+type s struct {
+	// i is guarded by mu.
+	i int
+	// Exported is guarded by Mu.
+	Exported int
+	// ignored is guarded by mu.
+	ignored int
+	mu      sync.Mutex
+	Mu      sync.Mutex
+}
+
+func (s *s) unprotected() {
+	s.i++        // want `not protected access to shared field i, use s.mu.Lock()`
+	s.Exported++ // want `not protected access to shared field Exported, use s.Mu.Lock()`
+	s.ignored++
+}
+
+func (s *s) protected() {
+	s.mu.Lock()
+	s.i++
+	s.mu.Unlock()
+
+	s.Mu.Lock()
+	s.Exported++
+	s.Mu.Unlock()
+}
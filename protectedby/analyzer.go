@@ -3,22 +3,48 @@ package protectedby
 import (
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"go/types"
+	"slices"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/tools/go/analysis"
-	"golang.org/x/tools/go/analysis/passes/inspect"
-	"golang.org/x/tools/go/ast/astutil"
 )
 
 const (
-	protectedBy   = "protected by "
-	testDirective = "// want `"
+	defaultProtectedBy = "protected by"
+	accessedAtomically = "accessed atomically"
+	immutable          = "immutable"
+	readOnlyAfterInit  = "read-only after init"
+	confinedTo         = "confined to "
+	testDirective      = "// want "
+
+	// readOnlyAfterInitialization is the spelled out form of readOnlyAfterInit.
+	readOnlyAfterInitialization = "read-only after initialization"
 )
 
-var testRun bool
+// Diagnostic categories. They are stable identifiers of the kinds of diagnostics, e.g. SARIF rule IDs.
+const (
+	categoryUnprotectedAccess    = "unprotected-access"
+	categoryExportedField        = "exported-protected-field"
+	categoryExportedMutex        = "exported-mutex"
+	categoryLockNotLocker        = "lock-not-locker"
+	categoryUnknownLock          = "unknown-lock"
+	categoryAnnotationParseError = "annotation-parse-error"
+	categoryInvalidAnnotation    = "invalid-annotation"
+	categoryUsageOutsideFunction = "usage-outside-function"
+	categoryEscapingReference    = "escaping-reference"
+	categoryUnprotectedCall      = "unprotected-call"
+	categoryNonAtomicAccess      = "non-atomic-access"
+	categoryImmutableWrite       = "immutable-write"
+	categoryConfinedAccess       = "confined-access"
+	categoryLockOrder            = "lock-order"
+	categoryBlocking             = "blocking-while-locked"
+	categoryProtectedCopy        = "protected-copy"
+)
 
 var syncLocker = types.NewInterfaceType(
 	[]*types.Func{
@@ -31,402 +57,780 @@ var syncLocker = types.NewInterfaceType(
 ).Complete()
 
 type analysisError struct {
-	msg string
-	pos token.Pos
+	msg      string
+	pos      token.Pos
+	category string
+	related  []analysis.RelatedInformation
 }
 
 func (e analysisError) Error() string {
 	return e.msg
 }
 
-type protectedData struct {
+// annotations holds all annotated fields of a package grouped by the annotation kind. The maps are keyed by
+// protectedName.
+type annotations struct {
+	protected map[string]*protectedData
+	atomic    map[string]*atomicData
+	immutable map[string]*immutableData
+	confined  map[string]*confinedData
+	// order are the declared orders of lock fields.
+	order []*lockOrderData
+	conds condLocks
+	// suppressed are the annotated fields excluded from the checks by Config.Suppress with the descriptions of their
+	// annotations, see annotation.
+	suppressed map[string]string
+}
+
+// suppress removes the annotated fields with the given qualified names, e.g. "example.com/cache.Cache.items", so that
+// they are not checked. The removed names are kept in suppressed.
+func (a *annotations) suppress(pass *analysis.Pass, names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	prefix := pass.Pkg.Path() + "."
+	for _, name := range names {
+		pName, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		annotation, _ := a.annotation(pName)
+		if annotation == "" {
+			continue
+		}
+
+		delete(a.protected, pName)
+		delete(a.atomic, pName)
+		delete(a.immutable, pName)
+		delete(a.confined, pName)
+		a.suppressed[pName] = annotation
+	}
+}
+
+// fields returns all annotated fields regardless of the annotation kind keyed by the field declaration.
+func (a *annotations) fields() map[*types.Var]*fieldData {
+	res := make(map[*types.Var]*fieldData, len(a.protected)+len(a.atomic)+len(a.immutable)+len(a.confined))
+	for _, p := range a.protected {
+		res[p.obj] = p.fieldData
+	}
+	for _, d := range a.atomic {
+		res[d.obj] = d.fieldData
+	}
+	for _, d := range a.immutable {
+		res[d.obj] = d.fieldData
+	}
+	for _, d := range a.confined {
+		res[d.obj] = d.fieldData
+	}
+
+	return res
+}
+
+// fieldData is an annotated struct field together with the places it is used.
+type fieldData struct {
 	field           *ast.Field
-	lock            *ast.Field
-	enclosingStruct *ast.TypeSpec
-	usages          []*usage
+	enclosingStruct *structInfo
+	// obj is the declared field. Fields of generic struct instantiations refer to it via types.Var.Origin().
+	obj *types.Var
+	// annotation is the comment the field is annotated with.
+	annotation *ast.Comment
+	usages     []*usage
+}
+
+func newFieldData(pass *analysis.Pass, st *structInfo, field *ast.Field, annotation *ast.Comment) *fieldData {
+	obj, _ := pass.TypesInfo.Defs[field.Names[0]].(*types.Var)
+	return &fieldData{
+		field:           field,
+		enclosingStruct: st,
+		obj:             obj,
+		annotation:      annotation,
+	}
+}
+
+// evidence returns the related information of diagnostics about the field: the annotation.
+func (d *fieldData) evidence() []analysis.RelatedInformation {
+	return []analysis.RelatedInformation{annotationInfo(d.annotation, "field %s annotated here", getFieldName(d.field))}
+}
+
+func annotationInfo(c *ast.Comment, format string, args ...any) analysis.RelatedInformation {
+	return analysis.RelatedInformation{Pos: c.Pos(), End: c.End(), Message: fmt.Sprintf(format, args...)}
+}
+
+type protectedData struct {
+	*fieldData
+	lock *ast.Field
+	// lockDepth is the number of structs between the field and the lock: 0 if the lock is declared in the same struct
+	// as the field, 1 if the lock is declared in the struct enclosing the anonymous struct of the field, and so on.
+	lockDepth int
+}
+
+// evidence returns the related information of diagnostics about the field: the annotation and the lock declaration.
+func (p *protectedData) evidence() []analysis.RelatedInformation {
+	return []analysis.RelatedInformation{
+		annotationInfo(p.annotation, "%s is protected by %s", getFieldName(p.field), getFieldName(p.lock)),
+		{
+			Pos:     p.lock.Pos(),
+			End:     p.lock.End(),
+			Message: fmt.Sprintf("lock %s declared here", getFieldName(p.lock)),
+		},
+	}
+}
+
+// releaseInfo returns the related information pointing at the release of a lock.
+func releaseInfo(op *lockOp) analysis.RelatedInformation {
+	return analysis.RelatedInformation{
+		Pos:     op.node.Pos(),
+		End:     op.node.End(),
+		Message: fmt.Sprintf("%s released here", types.ExprString(op.lock)),
+	}
+}
+
+// structInfo describes the struct that declares an annotated field. The struct can be anonymous, e.g. a type of
+// a variable or a field of another struct.
+type structInfo struct {
+	// name is used in diagnostics, e.g. "s1" for a named struct, "server.stats" for a field of an anonymous struct
+	// type or "state" for a variable of an anonymous struct type.
+	name string
+	// types are the struct type that declares the field followed by the struct types enclosing it, innermost first.
+	types []*ast.StructType
 }
 
 type usage struct {
-	file          *ast.File
+	file     *ast.File
+	selector *ast.SelectorExpr
+	// selectorXID is the root identifier of the selector, e.g. s for s.stats.hits.
 	selectorXID   *ast.Ident
 	enclosingFunc *ast.FuncDecl
 	deferStmt     *ast.DeferStmt
+	// locks is the lock state of the enclosing function.
+	locks *funcLockState
+	// path is the path from the selector up to the root of the file, innermost first.
+	path []ast.Node
 }
 
-var Analyzer = &analysis.Analyzer{
-	Name:     "protectedby",
-	Doc:      "Checks that access to shared resources is protected.",
-	Run:      run,
-	Requires: []*analysis.Analyzer{inspect.Analyzer},
-}
+func (c *Config) run(pass *analysis.Pass) (interface{}, error) {
+	if err := c.Severity.validate(); err != nil {
+		return nil, err
+	}
 
-func run(pass *analysis.Pass) (interface{}, error) {
-	protectedMap, errors := parseComments(pass)
-	if errors != nil {
+	// report reports the errors of a phase and returns true if the remaining phases must be skipped.
+	report := func(errors []*analysisError) bool {
 		for _, e := range errors {
-			pass.Report(analysis.Diagnostic{Pos: e.pos, Message: e.Error()})
-		}
-		if !testRun {
-			return nil, nil
+			pass.Report(analysis.Diagnostic{Pos: e.pos, Category: e.category, Message: e.Error(), Related: e.related})
 		}
+		return errors != nil && c.StopAfterErrors
 	}
 
-	errors = addUsages(pass, protectedMap)
-	if errors != nil {
-		for _, e := range errors {
-			pass.Report(analysis.Diagnostic{Pos: e.pos, Message: e.Error()})
-		}
-		if !testRun {
-			return nil, nil
-		}
+	col := collect(pass)
+	annotated, errors := parseComments(pass, c, col.fields)
+	r := newRunState(pass, col.locks, findCondLocks(pass, annotated.conds))
+	if report(errors) {
+		return newCoverage(pass, col.fields, annotated), nil
 	}
 
-	errors = checkLocksUsed(pass, protectedMap)
-	if errors != nil {
-		for _, e := range errors {
-			pass.Report(analysis.Diagnostic{Pos: e.pos, Message: e.Error()})
-		}
-		if !testRun {
-			return nil, nil
-		}
+	preconds, errors := findPreconditions(pass)
+	if report(errors) {
+		return newCoverage(pass, col.fields, annotated), nil
+	}
+
+	if report(addUsages(annotated.fields(), col.selections)) {
+		return newCoverage(pass, col.fields, annotated), nil
 	}
 
-	return nil, nil
+	// Checks of different annotation kinds are independent, so all of them run before reporting.
+	errors = append(checkLocksUsed(r, annotated.protected, preconds), checkAtomicAccess(pass, annotated.atomic)...)
+	errors = append(errors, checkPreconditionCalls(r, col.calls, preconds)...)
+	errors = append(errors, checkCondWaits(r, col.calls, preconds)...)
+	errors = append(errors, checkImmutableWrites(r, annotated.immutable)...)
+	errors = append(errors, checkConfinedAccess(r, annotated.confined)...)
+	errors = append(errors, checkLockOrder(r, annotated.order)...)
+	errors = append(errors, checkBlockingOps(r, c, annotated.protected)...)
+	errors = append(errors, checkCopies(r, annotated.protected)...)
+	errors = append(errors, checkChanLocks(pass, annotated.protected)...)
+	report(errors)
+
+	return newCoverage(pass, col.fields, annotated), nil
 }
 
-func parseComments(pass *analysis.Pass) (map[string]*protectedData, []*analysisError) {
-	res := make(map[string]*protectedData)
+// parseComments returns annotated fields of the package. A malformed annotation is returned as an error and its field
+// is skipped, the other fields are still annotated.
+func parseComments(pass *analysis.Pass, cfg *Config, fields []*fieldNode) (*annotations, []*analysisError) {
+	res := &annotations{
+		protected:  make(map[string]*protectedData),
+		atomic:     make(map[string]*atomicData),
+		immutable:  make(map[string]*immutableData),
+		confined:   make(map[string]*confinedData),
+		conds:      make(condLocks),
+		suppressed: make(map[string]string),
+	}
 	var errors []*analysisError
+	patterns := cfg.protectedByPatterns()
+
+	for _, n := range fields {
+		field := n.field
+		// Skip embedded fields and blank identifiers.
+		fieldName := getFieldName(field)
+		if fieldName == "" || fieldName == "_" {
+			continue
+		}
 
-	for _, f := range pass.Files {
-		commentMap := ast.NewCommentMap(pass.Fset, f, f.Comments)
+	commentGroup:
+		for _, cg := range n.comments {
+			for _, comment := range cg.List {
+				text := strings.ToLower(annotationText(comment))
+				isProtected := containsAny(text, patterns)
+				isAtomic := phraseIndex(text, accessedAtomically) != -1
+				isImmutable := phraseIndex(text, immutable) != -1 || phraseIndex(text, readOnlyAfterInit) != -1 ||
+					phraseIndex(text, readOnlyAfterInitialization) != -1
+				isConfined := phraseIndex(text, confinedTo) != -1
+				isOrdered := (phraseIndex(text, acquiredBefore) != -1 || phraseIndex(text, acquiredAfter) != -1) &&
+					isLock(pass, field)
+				isCond := phraseIndex(text, associatedWith) != -1 && isSyncCond(pass.TypesInfo.TypeOf(field.Type))
+				if !isProtected && !isAtomic && !isImmutable && !isConfined && !isOrdered && !isCond {
+					continue
+				}
 
-		for node, commentMapGroups := range commentMap {
-			// Filter out nodes that are not fields. The linter only works for struct fields protected
-			// by another field.
-			field, ok := node.(*ast.Field)
-			if !ok {
-				continue
-			}
-			// Skip embedded fields and blank identifiers.
-			fieldName := getFieldName(field)
-			if fieldName == "" || fieldName == "_" {
-				continue
-			}
+				st := getEnclosingStruct(n.path)
+				if st == nil {
+					continue commentGroup
+				}
 
-		commentGroup:
-			for _, cg := range commentMapGroups {
-				for _, comment := range cg.List {
-					if !strings.Contains(strings.ToLower(comment.Text), protectedBy) {
-						continue
+				pName := protectedName(st.name, fieldName)
+				switch {
+				case isProtected:
+				case isAtomic:
+					d, err := getAtomicData(pass, st, field, comment)
+					if err != nil {
+						errors = append(errors, err)
+						continue commentGroup
 					}
 
-					spec := getEnclosingStruct(f, comment.Pos(), comment.End())
-					if spec == nil {
+					res.atomic[pName] = d
+					continue commentGroup
+				case isImmutable:
+					res.immutable[pName] = getImmutableData(pass, st, field, comment)
+					continue commentGroup
+				case isConfined:
+					d, err := getConfinedData(pass, st, field, comment)
+					if err != nil {
+						errors = append(errors, err)
 						continue commentGroup
 					}
+					if d == nil {
+						continue
+					}
 
-					if token.IsExported(fieldName) {
-						errors = append(errors, &analysisError{
-							msg: fmt.Sprintf("exported protected field %s.%s", spec.Name, fieldName),
-							pos: field.Pos(),
-						})
+					res.confined[pName] = d
+					continue commentGroup
+				case isOrdered:
+					o, err := getLockOrder(pass, st, field, comment)
+					if err != nil {
+						errors = append(errors, err)
 						continue commentGroup
 					}
 
-					lock, err := getLock(pass, spec, comment)
+					res.order = append(res.order, o)
+					continue commentGroup
+				case isCond:
+					lock, err := getCondLock(pass, st, comment)
 					if err != nil {
 						errors = append(errors, err)
 						continue commentGroup
 					}
 
-					p := &protectedData{
-						field:           field,
-						lock:            lock,
-						enclosingStruct: spec,
+					if obj, ok := pass.TypesInfo.Defs[field.Names[0]].(*types.Var); ok && lock != nil {
+						res.conds[obj] = lock
 					}
+					continue commentGroup
+				}
+
+				if token.IsExported(fieldName) && !cfg.AllowExported {
+					errors = append(errors, &analysisError{
+						msg:      fmt.Sprintf("exported protected field %s.%s", st.name, fieldName),
+						pos:      field.Pos(),
+						category: categoryExportedField,
+					})
+					continue commentGroup
+				}
+
+				lock, lockDepth, err := getLock(pass, cfg, st, comment)
+				if err != nil {
+					errors = append(errors, err)
+					continue commentGroup
+				}
 
-					pName := protectedName(spec.Name.Name, fieldName)
-					res[pName] = p
-					break
+				p := &protectedData{
+					fieldData: newFieldData(pass, st, field, comment),
+					lock:      lock,
+					lockDepth: lockDepth,
 				}
+
+				res.protected[pName] = p
+				break
 			}
 		}
 	}
+	res.suppress(pass, cfg.Suppress)
 
 	return res, errors
 }
 
+// isChanLock reports whether the lock is a channel. A channel with capacity one can be used as a mutex: sending to
+// the channel acquires the lock and receiving from it releases the lock.
+func isChanLock(pass *analysis.Pass, f *ast.Field) bool {
+	ch, ok := pass.TypesInfo.TypeOf(f.Type).Underlying().(*types.Chan)
+	return ok && ch.Dir() == types.SendRecv
+}
+
+// checkChanLocks reports channels used as locks that are made with a capacity other than one in the package. The
+// capacity of channels made elsewhere or with a non-constant capacity is not verified.
+func checkChanLocks(pass *analysis.Pass, m map[string]*protectedData) []*analysisError {
+	locks := make(map[types.Object]*protectedData)
+	for _, p := range m {
+		if obj := pass.TypesInfo.Defs[p.lock.Names[0]]; obj != nil && isChanLock(pass, p.lock) && locks[obj] == nil {
+			locks[obj] = p
+		}
+	}
+	if len(locks) == 0 {
+		return nil
+	}
+
+	var errors []*analysisError
+	for obj, values := range chanAssigns(pass) {
+		p := locks[obj]
+		if p == nil {
+			continue
+		}
+		for _, v := range values {
+			capacity, ok := makeChanCap(pass, v)
+			if !ok || capacity == nil || constant.Compare(capacity, token.EQL, constant.MakeInt64(1)) {
+				continue
+			}
+			errors = append(errors, &analysisError{
+				msg:      fmt.Sprintf("lock %s is a channel with capacity %s, expected capacity one", obj.Name(), capacity),
+				pos:      v.Pos(),
+				category: categoryLockNotLocker,
+				related:  p.evidence(),
+			})
+		}
+	}
+
+	return errors
+}
+
+// isLock reports whether the field can be used as a lock: it implements sync.Locker or is a channel.
+func isLock(pass *analysis.Pass, f *ast.Field) bool {
+	return implementsLocker(pass, f) || isChanLock(pass, f)
+}
+
 func implementsLocker(pass *analysis.Pass, f *ast.Field) bool {
 	realType := pass.TypesInfo.TypeOf(f.Type)
 	ptrType := types.NewPointer(realType)
 	return types.Implements(realType, syncLocker) || types.Implements(ptrType, syncLocker)
 }
 
-func addUsages(pass *analysis.Pass, protectedMap map[string]*protectedData) []*analysisError {
+// addUsages adds field selections of annotated fields to their usages. A selection that is a part of a longer chain
+// of annotated field selections, e.g. s.stats in s.stats.hits if both fields are annotated, is not a usage on its own.
+func addUsages(fields map[*types.Var]*fieldData, selections []*fieldSelection) []*analysisError {
 	var errors []*analysisError
+	covered := make(map[*ast.SelectorExpr]bool)
 
-	for _, file := range pass.Files {
-		ast.Inspect(file, func(n ast.Node) bool {
-			switch se := n.(type) {
-			case *ast.SelectorExpr:
-				id, ok := se.X.(*ast.Ident)
-				if !ok {
-					return false
-				}
+	for _, s := range selections {
+		p, ok := fields[s.obj]
+		if !ok || covered[s.selector] {
+			continue
+		}
+		for x := ast.Unparen(s.selector.X); ; {
+			se, ok := x.(*ast.SelectorExpr)
+			if !ok {
+				break
+			}
+			covered[se] = true
+			x = ast.Unparen(se.X)
+		}
 
-				xtyp := deref(pass.TypesInfo.TypeOf(se.X))
-				// The type of the accessor must be named.
-				named, ok := xtyp.(*types.Named)
-				if !ok {
-					return false
-				}
+		if s.enclosingFunc == nil {
+			errors = append(errors, &analysisError{
+				msg:      "no enclosing function",
+				pos:      s.selector.X.Pos(),
+				category: categoryUsageOutsideFunction,
+			})
+			continue
+		}
 
-				// Use typed name to lookup a corresponding protected field.
-				pName := protectedName(named.Obj().Name(), se.Sel.Name)
-				p, ok := protectedMap[pName]
-				if !ok {
-					return false
-				}
+		p.usages = append(p.usages, s.usage)
+	}
 
-				fn, deferStmt, err := findEnclosingFunction(se.X.Pos(), se.X.End(), file)
-				if err != nil {
-					errors = append(errors, err)
-					return false
-				}
+	return errors
+}
 
-				p.usages = append(p.usages, &usage{
-					file:          file,
-					selectorXID:   id,
-					enclosingFunc: fn,
-					deferStmt:     deferStmt,
-				})
+// rootIdent returns the identifier a chain of field selections starts with, e.g. s for s.stats, or nil if the
+// expression is not such a chain.
+func rootIdent(pass *analysis.Pass, expr ast.Expr) *ast.Ident {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.Ident:
+		return e
+	case *ast.SelectorExpr:
+		if sel, ok := pass.TypesInfo.Selections[e]; !ok || sel.Kind() != types.FieldVal {
+			return nil
+		}
+		return rootIdent(pass, e.X)
+	}
+
+	return nil
+}
 
-				return false
+func checkLocksUsed(r *runState, m map[string]*protectedData, preconds preconditions) []*analysisError {
+	pass := r.pass
+	var errors []*analysisError
+	for _, p := range m {
+		for _, u := range p.usages {
+			ref := r.usageLockRef(u, p)
+			heldOnEntry := preconds.heldOnEntry(r, u.enclosingFunc, ref.matchesKey)
+			s := u.site()
+			s.readOnly = !isWrite(pass, u, true)
+
+			if !isLockHeld(s, ref, heldOnEntry) {
+				base := lockBase(u, p)
+				if base == nil {
+					base = u.selector.X
+				}
+				hint := fmt.Sprintf("use %s.%s.Lock()", types.ExprString(base), getFieldName(p.lock))
+				if isChanLock(pass, p.lock) {
+					hint = fmt.Sprintf("send to %s.%s", types.ExprString(base), getFieldName(p.lock))
+				}
+				related := p.evidence()
+				expected := fmt.Sprintf("%s.%s", types.ExprString(base), getFieldName(p.lock))
+				reason, info := notHeldReason(pass, s, ref, heldOnEntry, expected, pass.TypesInfo.Defs[p.lock.Names[0]])
+				if reason != "" {
+					hint = reason
+					related = append(related, info...)
+				}
+				errors = append(errors, &analysisError{
+					msg:      fmt.Sprintf("not protected access to shared field %s, %s", getFieldName(p.field), hint),
+					pos:      u.selectorXID.Pos(),
+					category: categoryUnprotectedAccess,
+					related:  related,
+				})
+				continue
 			}
 
-			return true
-		})
+			if err := escapeError(r, p, u, ref); err != nil {
+				errors = append(errors, err)
+			}
+		}
 	}
 
 	return errors
 }
 
-func findEnclosingFunction(start, end token.Pos, file *ast.File) (*ast.FuncDecl, *ast.DeferStmt, *analysisError) {
-	path, _ := astutil.PathEnclosingInterval(file, start, end)
+// site is a position in a function where a lock must be held.
+type site struct {
+	file *ast.File
+	fn   *ast.FuncDecl
+	// deferStmt is the deferred statement that encloses the position, if any.
+	deferStmt *ast.DeferStmt
+	pos       token.Pos
+	// locks is the lock state of the function.
+	locks *funcLockState
+	// readOnly is true if the site only reads a protected field, a read lock is sufficient then.
+	readOnly bool
+}
 
-	// Find the function declaration that encloses the positions.
-	var outer *ast.FuncDecl
-	var deferStmt *ast.DeferStmt
-	for _, p := range path {
-		// Deferred access to a protected field is validated differently.
-		if d, ok := p.(*ast.DeferStmt); ok {
-			deferStmt = d
-		}
+func (u *usage) site() site {
+	return site{
+		file:      u.file,
+		fn:        u.enclosingFunc,
+		deferStmt: u.deferStmt,
+		pos:       u.selectorXID.Pos(),
+		locks:     u.locks,
+	}
+}
 
-		if p, ok := p.(*ast.FuncDecl); ok {
-			outer = p
-			break
-		}
+// isLockHeld reports whether the lock is acquired before the site and not released afterwards. If heldOnEntry is true,
+// the lock is held when the function is called, see preconditions.
+func isLockHeld(s site, l lockRef, heldOnEntry bool) bool {
+	if op := findAcquiredLock(s, l); op != nil && !isReleased(s, op.lock.Pos(), l) {
+		return true
 	}
+	if pos := findTryLock(s, l); pos.IsValid() && !isReleased(s, pos, l) {
+		return true
+	}
+
+	return heldOnEntry && !isReleased(s, s.fn.Body.Pos(), l)
+}
 
-	if outer == nil {
-		return nil, nil, &analysisError{
-			msg: "no enclosing function",
-			pos: start,
+// findAcquiredLock returns the last acquisition of the lock before the site. Read locks are only taken into account if
+// the site only reads, see site.readOnly.
+func findAcquiredLock(s site, l lockRef) *lockOp {
+	var res *lockOp
+	for _, ops := range s.locks.acquiredIdx.lists(l) {
+		for i := lastBefore(ops, s.pos); i >= 0; i-- {
+			op := ops[i]
+			// Skip locks acquired outside the function.
+			if op.node.Pos() <= s.fn.Body.Pos() {
+				break
+			}
+			if op.read && !s.readOnly {
+				continue
+			}
+			// Access to a protected field can be deferred. Skip locks acquired in other deferred statements.
+			if op.visibleFrom(s) {
+				if res == nil || op.node.Pos() > res.node.Pos() {
+					res = op
+				}
+				break
+			}
 		}
 	}
 
-	return outer, deferStmt, nil
+	return res
 }
 
-func checkLocksUsed(pass *analysis.Pass, m map[string]*protectedData) []*analysisError {
-	var errors []*analysisError
-	for _, p := range m {
-		for _, u := range p.usages {
-			found := false
-			var lockExpr *ast.SelectorExpr
-			ast.Inspect(u.enclosingFunc, func(curr ast.Node) bool {
-				if curr == nil {
-					return false
-				}
+// findOffendingRelease returns the release of the lock if the lock is acquired before the site and released before
+// the site afterwards.
+func findOffendingRelease(s site, l lockRef) *lockOp {
+	op := findAcquiredLock(s, l)
+	if op == nil {
+		return nil
+	}
 
-				// Access to a protected field can be deferred. Skip node if this is a defer statement
-				// that is not the same where the field is accessed.
-				if deferStmt, ok := curr.(*ast.DeferStmt); ok {
-					return deferStmt == u.deferStmt
-				}
+	return findRelease(s, op.lock.Pos(), l)
+}
 
-				cexpr, ok := curr.(*ast.CallExpr)
-				if !ok {
-					return true
-				}
-				fnSelector, ok := cexpr.Fun.(*ast.SelectorExpr)
-				if !ok {
-					return true
-				}
+// findUnlock returns the release of the lock of the usage between the given positions, or nil if the lock is not
+// released.
+func findUnlock(u *usage, from, to token.Pos, l lockRef) *lockOp {
+	s := u.site()
+	s.pos = to
+	return findRelease(s, from, l)
+}
 
-				// Return if the function is not "Lock". At this point we already checked that the lock implements
-				// sync.Locker interface, namely Lock() function, hence it cannot have another function with
-				// a name Lock and arguments -- overloading is forbidden in go.
-				if fnSelector.Sel.Name != "Lock" {
-					return true
-				}
+// isReleased reports whether the lock is released after the given position and before the site.
+func isReleased(s site, from token.Pos, l lockRef) bool {
+	return findRelease(s, from, l) != nil
+}
 
-				// Return if the function call is outside the function or after the protected field access.
-				if curr.Pos() <= u.enclosingFunc.Body.Pos() || curr.Pos() >= u.selectorXID.Pos() {
-					return false
-				}
+// findRelease returns the last release of the lock after the given position and before the site, or nil if the lock
+// is not released.
+func findRelease(s site, from token.Pos, l lockRef) *lockOp {
+	var res *lockOp
+	for _, ops := range s.locks.releasedIdx.lists(l) {
+		// Skip locks released before they are acquired or after access to the protected field.
+		if i := lastBefore(ops, s.pos); i >= 0 && ops[i].node.Pos() > from {
+			if res == nil || ops[i].node.Pos() > res.node.Pos() {
+				res = ops[i]
+			}
+		}
+	}
 
-				/*
-					Function expression must be a SelectorExpr because the following is not valid:
-					s := s1{}      // a struct with a protected field and a mutex mu.
-					copyMu := s.mu // this copies mutex, i.e. copyMu.Lock() will not protect the field. This is reported
-						           // by go vet: "assignment copies lock value to mu: sync.Mutex".
-					copyMu.Lock()
-				*/
-				selExpr, ok := fnSelector.X.(*ast.SelectorExpr)
-				if !ok {
-					return true
-				}
+	// If the lock is released from within deferred function it must be the same deferred statement as the deferred
+	// statement where current usage happened.
+	if res != nil && res.deferStmt != s.deferStmt {
+		return nil
+	}
 
-				sxid, ok := selExpr.X.(*ast.Ident)
-				if !ok {
-					return true
-				}
+	return res
+}
 
-				if pass.TypesInfo.ObjectOf(sxid) == pass.TypesInfo.ObjectOf(u.selectorXID) {
-					found = true
-					lockExpr = fnSelector
-					return false
-				}
+// acquiredLock returns the lock expression, e.g. s.mu, if the node acquires a lock: either calls Lock() or sends to
+// a channel.
+func acquiredLock(n ast.Node) ast.Expr {
+	switch n := n.(type) {
+	case *ast.CallExpr:
+		return lockMethodReceiver(n, "Lock")
+	case *ast.SendStmt:
+		return lockOperand(n.Chan)
+	}
 
-				return true
-			})
+	return nil
+}
 
-			if !found || isUnlockCalled(pass, u, lockExpr) {
-				errors = append(errors, &analysisError{
-					msg: fmt.Sprintf("not protected access to shared field %s, use %s.%s.Lock()",
-						getFieldName(p.field),
-						u.selectorXID.Name,
-						getFieldName(p.lock),
-					),
-					pos: u.selectorXID.Pos(),
-				})
-			}
-		}
+// readLockCall returns the lock expression, e.g. s.mu, if the node is a call of the read lock method, i.e. RLock() or
+// RUnlock().
+func readLockCall(n ast.Node, method string) ast.Expr {
+	call, ok := n.(*ast.CallExpr)
+	if !ok {
+		return nil
 	}
 
-	return errors
+	return lockMethodReceiver(call, method)
 }
 
-func isUnlockCalled(pass *analysis.Pass, u *usage, lockExpr *ast.SelectorExpr) bool {
-	unlocked := false
-	ast.Inspect(u.enclosingFunc, func(curr ast.Node) bool {
-		if curr == nil {
-			return false
+// releasedLock returns the lock expression, e.g. s.mu, if the node releases a lock: either calls Unlock() or receives
+// from a channel.
+func releasedLock(n ast.Node) ast.Expr {
+	switch n := n.(type) {
+	case *ast.CallExpr:
+		return lockMethodReceiver(n, "Unlock")
+	case *ast.UnaryExpr:
+		if n.Op != token.ARROW {
+			return nil
 		}
+		return lockOperand(n.X)
+	}
 
-		cexpr, ok := curr.(*ast.CallExpr)
-		if !ok {
-			return true
-		}
-		fnSelector, ok := cexpr.Fun.(*ast.SelectorExpr)
-		if !ok {
-			return true
-		}
+	return nil
+}
 
-		if fnSelector.Sel.Name != "Unlock" {
-			return true
-		}
+// lockMethodReceiver returns the receiver of the call if the called method has the given name.
+func lockMethodReceiver(call *ast.CallExpr, method string) ast.Expr {
+	fnSelector, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
 
-		withinRange := curr.Pos() > lockExpr.Pos() && curr.Pos() < u.selectorXID.Pos()
-		// Return if the Unlock() is called before Lock() or after access to the protected field.
-		if !withinRange {
-			return false
-		}
+	// At this point we already checked that the lock implements sync.Locker interface, namely Lock() function,
+	// hence it cannot have another function with a name Lock and arguments -- overloading is forbidden in go.
+	if fnSelector.Sel.Name != method {
+		return nil
+	}
 
-		/*
-			function expression must be a SelectorExpr because the following is not valid:
-			s := s1{}      // a struct with a protected field and a mutex mu.
-			copyMu := s.mu // this copies mutex, i.e. copyMu.Lock() will not protect the field. This is reported
-				           // by go vet: "assignment copies lock value to mu: sync.Mutex".
-			copyMu.Lock()
-		*/
-		selExpr, ok := fnSelector.X.(*ast.SelectorExpr)
-		if !ok {
-			return true
-		}
+	return lockOperand(fnSelector.X)
+}
 
-		sxid, ok := selExpr.X.(*ast.Ident)
-		if !ok {
-			return true
-		}
+/*
+lockOperand returns the expression if it can refer to a lock, i.e. it is a selector or a variable. A variable refers to
+a lock only if it is an alias of a pointer or interface lock field, see lockAliases, because the following is not valid:
+
+	s := s1{}      // a struct with a protected field and a mutex mu.
+	copyMu := s.mu // this copies mutex, i.e. copyMu.Lock() will not protect the field. This is reported
+	               // by go vet: "assignment copies lock value to mu: sync.Mutex".
+	copyMu.Lock()
+*/
+func lockOperand(expr ast.Expr) ast.Expr {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.SelectorExpr, *ast.Ident:
+		return e
+	}
 
-		if pass.TypesInfo.ObjectOf(sxid) == pass.TypesInfo.ObjectOf(u.selectorXID) {
-			// If Unlock() is called from within deferred function
-			_, deferStmt, _ := findEnclosingFunction(curr.Pos(), curr.End(), u.file)
-			// it must be the same deferred statement as the deferred statement where current usage happened.
-			unlocked = deferStmt == u.deferStmt
-			return false
-		}
+	return nil
+}
 
-		return true
-	})
+// expectedLockKey returns the key of the lock that protects the field of the usage or noKey if the lock expression
+// cannot be determined.
+func (r *runState) expectedLockKey(u *usage, p *protectedData) lockKey {
+	base := lockBase(u, p)
+	if base == nil {
+		return noKey
+	}
+	baseKey := r.exprKey(base)
+	if baseKey == noKey {
+		return noKey
+	}
 
-	return unlocked
+	return r.key(baseKey, r.pass.TypesInfo.Defs[p.lock.Names[0]])
 }
 
-func getEnclosingStruct(f *ast.File, posStart, posEnd token.Pos) *ast.TypeSpec {
-	// Need TypeSpec here to get the struct name.
-	var spec *ast.TypeSpec
-	path, _ := astutil.PathEnclosingInterval(f, posStart, posEnd)
+// lockBase returns the expression the lock of the usage is selected from, e.g. s for s.stats.hits if hits is protected
+// by the lock s.mu declared in the struct enclosing the anonymous struct stats. Returns nil if the expression cannot
+// be determined.
+func lockBase(u *usage, p *protectedData) ast.Expr {
+	base := u.selector.X
+	for range p.lockDepth {
+		se, ok := ast.Unparen(base).(*ast.SelectorExpr)
+		if !ok {
+			return nil
+		}
+		base = se.X
+	}
+
+	return base
+}
+
+// getEnclosingStruct returns the struct that encloses a field given the path from the field's parent up to the file,
+// or nil if the field is not declared in a struct type. The struct can be a named type, a type of a variable or a type
+// of a field of another struct.
+func getEnclosingStruct(path []ast.Node) *structInfo {
+	var res *structInfo
+	// Names of the enclosing declarations, innermost first.
+	var names []string
+loop:
 	for _, p := range path {
-		if typeSpec, ok := p.(*ast.TypeSpec); ok {
-			if typeSpec.Name == nil {
-				continue
+		switch n := p.(type) {
+		case *ast.StructType:
+			if res == nil {
+				res = &structInfo{}
 			}
-			if _, ok := typeSpec.Type.(*ast.StructType); ok {
-				spec = typeSpec
-				break
+			res.types = append(res.types, n)
+		case *ast.Field:
+			if name := getFieldName(n); res != nil && name != "" {
+				names = append(names, name)
+			}
+		case *ast.TypeSpec:
+			if res != nil {
+				names = append(names, n.Name.Name)
 			}
+			break loop
+		case *ast.ValueSpec:
+			if res != nil {
+				names = append(names, n.Names[0].Name)
+			}
+			break loop
+		case ast.Stmt, ast.Decl:
+			break loop
 		}
 	}
 
-	return spec
+	if res == nil {
+		return nil
+	}
+
+	slices.Reverse(names)
+	res.name = strings.Join(names, ".")
+	if res.name == "" {
+		res.name = "struct{...}"
+	}
+
+	return res
 }
 
-func getLock(pass *analysis.Pass, spec *ast.TypeSpec, c *ast.Comment) (*ast.Field, *analysisError) {
-	lockName, err := getLockName(c, testRun)
+// getLock returns the lock field and the number of anonymous structs between the lock and the annotated field. The lock
+// is looked up in the innermost struct first, then in the enclosing ones.
+func getLock(pass *analysis.Pass, cfg *Config, st *structInfo, c *ast.Comment) (*ast.Field, int, *analysisError) {
+	lockName, err := getLockName(c, cfg.protectedByPatterns())
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	lock := getStructFieldByName(lockName, spec.Type.(*ast.StructType))
+	var lock *ast.Field
+	var depth int
+	for i, t := range st.types {
+		if lock = getStructFieldByName(lockName, t); lock != nil {
+			depth = i
+			break
+		}
+	}
 	if lock == nil {
-		return nil, &analysisError{
-			msg: fmt.Sprintf("struct %q does not have lock field %q", spec.Name.Name, lockName),
-			pos: c.Pos(),
+		return nil, 0, &analysisError{
+			msg:      fmt.Sprintf("struct %q does not have lock field %q", st.name, lockName),
+			pos:      c.Pos(),
+			category: categoryUnknownLock,
 		}
 	}
 
 	// Check if the lock field is exported after verifying that it exists. Otherwise may report
 	// "exported mutex" for not existing field.
-	if token.IsExported(lockName) {
-		return nil, &analysisError{
-			msg: fmt.Sprintf("exported mutex %s.%s", spec.Name.Name, lockName),
-			pos: lock.Pos(),
+	if token.IsExported(lockName) && !cfg.AllowExported {
+		return nil, 0, &analysisError{
+			msg:      fmt.Sprintf("exported mutex %s.%s", st.name, lockName),
+			pos:      lock.Pos(),
+			category: categoryExportedMutex,
+			related:  []analysis.RelatedInformation{annotationInfo(c, "%s referenced here", lockName)},
 		}
 	}
 
-	if !implementsLocker(pass, lock) {
-		return nil, &analysisError{
-			msg: fmt.Sprintf("lock %s doesn't implement sync.Locker interface", lockName),
-			pos: lock.Pos(),
+	if !implementsLocker(pass, lock) && !isChanLock(pass, lock) {
+		return nil, 0, &analysisError{
+			msg:      fmt.Sprintf("lock %s doesn't implement sync.Locker interface", lockName),
+			pos:      lock.Pos(),
+			category: categoryLockNotLocker,
+			related:  []analysis.RelatedInformation{annotationInfo(c, "%s referenced here", lockName)},
 		}
 	}
 
-	return lock, nil
+	return lock, depth, nil
 }
 
 func getStructFieldByName(name string, st *ast.StructType) *ast.Field {
@@ -441,45 +845,132 @@ func getStructFieldByName(name string, st *ast.StructType) *ast.Field {
 	return nil
 }
 
-// getLockName returns the first word in the comment after "protected by" statement or error if the statement is not
-// found or found more than once.
-func getLockName(comment *ast.Comment, testRun bool) (string, *analysisError) {
-	text := comment.Text
-	// analysistest uses comments of the form "// want ..." as an expected error message. A comment in a test file looks
-	// like "is protected by not existing mutex.// want `struct "s1" does not have lock field "not"`" i.e. contains
-	// multiple "protected by"'s. Since the analyser reacts on each "protected by" the code below excludes test
-	// directives from "// want `" till the end of the comment line.
-	if testRun {
-		if idx := strings.Index(comment.Text, testDirective); idx != -1 {
-			text = text[:idx]
-		}
-	}
+// getLockName returns the first word in the comment after "protected by" statement or another of the given patterns,
+// or error if the statement is not found or found more than once.
+func getLockName(comment *ast.Comment, patterns []string) (string, *analysisError) {
+	text := annotationText(comment)
 
 	// Compare "protected by " directive with lowercase comment because the directive can be a separate sentence i.e.
 	// starts with capital letter.
 	lowerCaseComment := strings.ToLower(text)
-	cnt := strings.Count(lowerCaseComment, protectedBy)
+	cnt := 0
+	idx, pattern := -1, ""
+	for _, p := range patterns {
+		if n := strings.Count(lowerCaseComment, p); n > 0 {
+			cnt += n
+			idx, pattern = strings.Index(lowerCaseComment, p), p
+		}
+	}
 	if cnt != 1 {
+		quoted := make([]string, len(patterns))
+		for i, p := range patterns {
+			quoted[i] = fmt.Sprintf("%q", p)
+		}
 		return "", &analysisError{
-			msg: fmt.Sprintf("found %d %q in comment %q, expected exact one", cnt, protectedBy, text),
-			pos: comment.Pos(),
+			msg:      fmt.Sprintf("found %d %s in comment %q, expected exact one", cnt, strings.Join(quoted, " or "), text),
+			pos:      comment.Pos(),
+			category: categoryAnnotationParseError,
 		}
 	}
 
-	// The index of "protected by " directive is guaranteed to be greater than -1 by checking count above.
-	idx := strings.Index(lowerCaseComment, protectedBy)
-	c := text[idx+len(protectedBy):]
+	// The index of the directive is guaranteed to be greater than -1 by checking count above.
+	c := text[idx+len(pattern):]
 	fields := strings.FieldsFunc(c, isLetterOrNumber)
 	if len(fields) == 0 {
 		return "", &analysisError{
-			msg: fmt.Sprintf("failed to parse lock name from comment %q", text),
-			pos: comment.Pos(),
+			msg:      fmt.Sprintf("failed to parse lock name from comment %q", text),
+			pos:      comment.Pos(),
+			category: categoryAnnotationParseError,
 		}
 	}
 
 	return fields[0], nil
 }
 
+// annotationText returns the comment text without test directives.
+func annotationText(comment *ast.Comment) string {
+	text := comment.Text
+	// analysistest uses comments of the form "// want ..." as an expected error message. A comment in a test file looks
+	// like "is protected by not existing mutex.// want `struct "s1" does not have lock field "not"`" i.e. contains
+	// multiple "protected by"'s. Since the analyser reacts on each "protected by" the code below excludes test
+	// directives from "// want " till the end of the comment line. The directives are excluded in all runs, so that
+	// tests check the same behaviour as users get. Prose such as "// want to keep i protected by mu" is kept.
+	if idx := directiveIndex(text); idx != -1 {
+		text = text[:idx]
+	}
+
+	return text
+}
+
+// directiveIndex returns the index of the first analysistest directive in the comment text or -1. A directive is
+// "// want " followed by an expected message in backquotes or double quotes, or by a fact of the form name:"fact".
+func directiveIndex(text string) int {
+	for from := 0; from < len(text); {
+		idx := strings.Index(text[from:], testDirective)
+		if idx == -1 {
+			return -1
+		}
+		idx += from
+		from = idx + 1
+
+		rest := strings.TrimLeft(text[idx+len(testDirective):], " ")
+		if name, fact, ok := strings.Cut(rest, ":"); ok && token.IsIdentifier(name) {
+			rest = fact
+		}
+		if strings.HasPrefix(rest, "`") || strings.HasPrefix(rest, `"`) {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// negations are the words that negate an annotation phrase following them, e.g. "is not accessed atomically".
+var negations = []string{"not", "never", "no", "isn't", "aren't", "nor"}
+
+// phraseIndex returns the index of the first occurrence of the annotation phrase in the lower case text, or -1. Like
+// the lock name after "protected by", the phrase must be separate words, i.e. "immutableCopy" does not contain
+// "immutable", and must not be negated, e.g. "is not accessed atomically".
+func phraseIndex(text, phrase string) int {
+	for from := 0; from < len(text); {
+		idx := strings.Index(text[from:], phrase)
+		if idx == -1 {
+			return -1
+		}
+		idx += from
+		from = idx + 1
+
+		before, after := text[:idx], text[idx+len(phrase):]
+		if r, _ := utf8.DecodeLastRuneInString(before); isWordRune(r) {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(after); !strings.HasSuffix(phrase, " ") && isWordRune(r) {
+			continue
+		}
+		if words := strings.Fields(before); len(words) > 0 && slices.Contains(negations, words[len(words)-1]) {
+			continue
+		}
+
+		return idx
+	}
+
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
 func isLetterOrNumber(c rune) bool {
 	return !unicode.IsLetter(c) && !unicode.IsNumber(c)
 }
@@ -3,14 +3,141 @@ package protectedby
 import (
 	"fmt"
 	"go/ast"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 
+	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/checker"
 )
 
 func TestAll(t *testing.T) {
-	testRun = true
-	analysistest.Run(t, analysistest.TestData(), Analyzer, "./...")
+	analysistest.Run(t, analysistest.TestData(), NewAnalyzer(Config{Blocking: true}), "protectedby/...")
+}
+
+func TestStopAfterErrors(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), NewAnalyzer(Config{StopAfterErrors: true}), "stopaftererrors")
+}
+
+func TestProtectedByPatterns(t *testing.T) {
+	a := NewAnalyzer(Config{})
+	if err := a.Flags.Set("protected-by", "protected by, guarded by"); err != nil {
+		t.Fatal(err)
+	}
+	analysistest.Run(t, analysistest.TestData(), a, "guardedby")
+}
+
+func TestSeverityFlag(t *testing.T) {
+	a := NewAnalyzer(Config{Severity: Severity{categoryProtectedCopy: LevelNote}})
+	if err := a.Flags.Set("severity", "blocking-while-locked=warning, lock-order = note"); err != nil {
+		t.Fatal(err)
+	}
+	sev := SeverityOf(a)
+	for category, want := range map[string]string{
+		categoryBlocking:          LevelWarning,
+		categoryLockOrder:         LevelNote,
+		categoryProtectedCopy:     LevelError,
+		categoryUnprotectedAccess: LevelError,
+	} {
+		if got := sev.Level(category); got != want {
+			t.Errorf("level of %s: got %q, want %q", category, got, want)
+		}
+	}
+
+	for _, v := range []string{"lock-order=fatal", "lock-order"} {
+		if err := a.Flags.Set("severity", v); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestCategories(t *testing.T) {
+	pkgs := loadPackages(t, analysistest.TestData(), "protectedby/...")
+	diags := runAnalyzer(t, pkgs)
+	if len(diags) == 0 {
+		t.Fatal("no diagnostics")
+	}
+	// Diagnostics of these categories are reported at the annotation itself, others point at it or at the lock.
+	atAnnotation := map[string]bool{
+		categoryAnnotationParseError: true,
+		categoryUnknownLock:          true,
+		categoryExportedField:        true,
+		categoryInvalidAnnotation:    true,
+	}
+	known := make(map[string]bool)
+	for _, c := range Categories() {
+		if known[c.ID] || c.Short == "" || c.Help == "" {
+			t.Errorf("duplicate or undocumented category %q", c.ID)
+		}
+		known[c.ID] = true
+	}
+	for _, d := range diags {
+		pos := pkgs[0].Fset.Position(d.Pos)
+		if !known[d.Category] {
+			t.Errorf("%s: diagnostic with unknown category %q: %s", pos, d.Category, d.Message)
+		}
+		if len(d.Related) == 0 && !atAnnotation[d.Category] {
+			t.Errorf("%s: %s diagnostic without related information: %s", pos, d.Category, d.Message)
+		}
+		for _, r := range d.Related {
+			if !r.Pos.IsValid() || r.Message == "" {
+				t.Errorf("%s: invalid related information %+v of %s", pos, r, d.Message)
+			}
+		}
+	}
+}
+
+// TestConcurrentRuns runs the analyzer on the same packages concurrently, the runs must not share state.
+func TestConcurrentRuns(t *testing.T) {
+	pkgs := loadPackages(t, analysistest.TestData(), "protectedby/...")
+	format := func(diags []analysis.Diagnostic) []string {
+		var res []string
+		for _, d := range diags {
+			res = append(res, fmt.Sprintf("%s: %s", pkgs[0].Fset.Position(d.Pos), d.Message))
+		}
+		slices.Sort(res)
+		return res
+	}
+	want := format(runAnalyzer(t, pkgs))
+
+	const runs = 8
+	results := make([][]string, runs)
+	errs := make([]error, runs)
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			graph, err := checker.Analyze([]*analysis.Analyzer{Analyzer}, pkgs, nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			var diags []analysis.Diagnostic
+			for act := range graph.All() {
+				if act.IsRoot && act.Analyzer == Analyzer {
+					if act.Err != nil {
+						errs[i] = act.Err
+						return
+					}
+					diags = append(diags, act.Diagnostics...)
+				}
+			}
+			results[i] = format(diags)
+		}()
+	}
+	wg.Wait()
+
+	for i := range runs {
+		if errs[i] != nil {
+			t.Fatalf("run %d: %v", i, errs[i])
+		}
+		if !slices.Equal(results[i], want) {
+			t.Errorf("run %d: got %d diagnostics, want %d", i, len(results[i]), len(want))
+		}
+	}
 }
 
 func Test_getLockName(t *testing.T) {
@@ -72,12 +199,22 @@ func Test_getLockName(t *testing.T) {
 			expectedLockName: lockName,
 			expectedError:    nil,
 		},
+		{
+			comment:          ast.Comment{Text: "// want to keep it protected by testLockName"},
+			expectedLockName: lockName,
+			expectedError:    nil,
+		},
+		{
+			comment:          ast.Comment{Text: "// protected by testLockName// want lock:\"fact\""},
+			expectedLockName: lockName,
+			expectedError:    nil,
+		},
 	}
 
-	const testRun = true
+	patterns := (&Config{}).protectedByPatterns()
 	for _, tc := range testCases {
 		t.Run(tc.comment.Text, func(t *testing.T) {
-			name, err := getLockName(&tc.comment, testRun)
+			name, err := getLockName(&tc.comment, patterns)
 			if !errorsEqual(tc.expectedError, err) {
 				t.Fatalf("expected error [%s], got [%s]", tc.expectedError, err)
 			}
@@ -103,3 +240,34 @@ func maybeErrorMessage(err error) string {
 	}
 	return err.Error()
 }
+
+func TestCoverage(t *testing.T) {
+	a := NewAnalyzer(Config{Suppress: []string{"coverage.store.hits"}})
+	results := analysistest.Run(t, analysistest.TestData(), a, "coverage")
+	c := results[0].Result.(*Coverage)
+
+	var got []string
+	for _, s := range c.Structs {
+		got = append(got, fmt.Sprintf("%s %v %d/%d", s.Name, s.Locks, s.Annotated(), len(s.Fields)))
+		for _, f := range s.Fields {
+			got = append(got, fmt.Sprintf("  %s %q suppressed=%t accesses=%d", f.Name, f.Annotation, f.Suppressed, f.Accesses))
+		}
+	}
+	got = append(got, fmt.Sprintf("suppressed %v", c.Suppressed))
+	want := []string{
+		"store [mu] 3/4",
+		`  items "protected by mu" suppressed=false accesses=2`,
+		`  hits "accessed atomically" suppressed=true accesses=0`,
+		`  cond "associated with mu" suppressed=false accesses=0`,
+		`  name "" suppressed=false accesses=0`,
+		"counter [sync.Mutex] 0/2",
+		`  n "" suppressed=false accesses=0`,
+		`  stats "" suppressed=false accesses=0`,
+		"counter.stats [mu] 1/1",
+		`  total "immutable" suppressed=false accesses=0`,
+		"suppressed [store.hits]",
+	}
+	if diff := lineDiff(strings.Join(want, "\n"), strings.Join(got, "\n")); diff != "" {
+		t.Errorf("unexpected coverage:\n%s", diff)
+	}
+}
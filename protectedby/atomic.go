@@ -0,0 +1,158 @@
+package protectedby
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+const syncAtomicPkg = "sync/atomic"
+
+// atomicData is a field annotated with "accessed atomically".
+type atomicData struct {
+	*fieldData
+	// typed is true if the field has one of the sync/atomic types, e.g. atomic.Int64. Such fields are accessed
+	// via their methods. Otherwise, the field is a plain integer or pointer accessed via sync/atomic functions.
+	typed bool
+}
+
+func getAtomicData(
+	pass *analysis.Pass, st *structInfo, field *ast.Field, c *ast.Comment,
+) (*atomicData, *analysisError) {
+	fieldName := getFieldName(field)
+	if token.IsExported(fieldName) {
+		return nil, &analysisError{
+			msg:      fmt.Sprintf("exported atomic field %s.%s", st.name, fieldName),
+			pos:      field.Pos(),
+			category: categoryExportedField,
+		}
+	}
+
+	d := &atomicData{
+		fieldData: newFieldData(pass, st, field, c),
+	}
+
+	typ := pass.TypesInfo.TypeOf(field.Type)
+	switch {
+	case isSyncAtomicType(typ):
+		d.typed = true
+	case isAtomicFuncOperand(typ):
+	default:
+		return nil, &analysisError{
+			msg:      fmt.Sprintf("field %s of type %s cannot be accessed atomically", fieldName, typ),
+			pos:      field.Pos(),
+			category: categoryInvalidAnnotation,
+		}
+	}
+
+	return d, nil
+}
+
+// isSyncAtomicType reports whether the type is declared in sync/atomic, e.g. atomic.Int64 or atomic.Pointer[T].
+func isSyncAtomicType(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return false
+	}
+	pkg := named.Obj().Pkg()
+	return pkg != nil && pkg.Path() == syncAtomicPkg
+}
+
+// isAtomicFuncOperand reports whether a value of the type can be passed by address to sync/atomic functions.
+func isAtomicFuncOperand(typ types.Type) bool {
+	b, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		return false
+	}
+
+	switch b.Kind() {
+	case types.Int32, types.Int64, types.Uint32, types.Uint64, types.Uintptr, types.UnsafePointer:
+		return true
+	}
+
+	return false
+}
+
+func checkAtomicAccess(pass *analysis.Pass, m map[string]*atomicData) []*analysisError {
+	var errors []*analysisError
+	for _, d := range m {
+		for _, u := range d.usages {
+			if d.typed && isMethodOrAddressOperand(u) || !d.typed && isAtomicCallArgument(pass, u) {
+				continue
+			}
+
+			msg := fmt.Sprintf("non-atomic access to field %s, use sync/atomic functions with &%s.%s",
+				getFieldName(d.field), types.ExprString(u.selector.X), getFieldName(d.field))
+			if d.typed {
+				msg = fmt.Sprintf("non-atomic access to field %s, use %s.%s methods instead of copying it",
+					getFieldName(d.field), types.ExprString(u.selector.X), getFieldName(d.field))
+			}
+			errors = append(errors, &analysisError{
+				msg:      msg,
+				pos:      u.selectorXID.Pos(),
+				category: categoryNonAtomicAccess,
+				related:  d.evidence(),
+			})
+		}
+	}
+
+	return errors
+}
+
+// isMethodOrAddressOperand reports whether the usage is either a method selector, e.g. s.f.Load(), or its address is
+// taken, e.g. &s.f.
+func isMethodOrAddressOperand(u *usage) bool {
+	parent, _ := parentExpr(u.path, 0)
+	switch p := parent.(type) {
+	case *ast.SelectorExpr:
+		return true
+	case *ast.UnaryExpr:
+		return p.Op == token.AND
+	}
+
+	return false
+}
+
+// isAtomicCallArgument reports whether the usage is an address argument of a sync/atomic function call, e.g.
+// atomic.AddInt64(&s.f, 1).
+func isAtomicCallArgument(pass *analysis.Pass, u *usage) bool {
+	parent, idx := parentExpr(u.path, 0)
+	unary, ok := parent.(*ast.UnaryExpr)
+	if !ok || unary.Op != token.AND {
+		return false
+	}
+
+	grandParent, _ := parentExpr(u.path, idx)
+	call, ok := grandParent.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != syncAtomicPkg {
+		return false
+	}
+
+	for _, arg := range call.Args {
+		if ast.Unparen(arg) == unary {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parentExpr returns the closest parent of path[i] that is not a parenthesized expression and its index in the path.
+func parentExpr(path []ast.Node, i int) (ast.Node, int) {
+	for j := i + 1; j < len(path); j++ {
+		if _, ok := path[j].(*ast.ParenExpr); !ok {
+			return path[j], j
+		}
+	}
+
+	return nil, len(path)
+}
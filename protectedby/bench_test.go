@@ -0,0 +1,163 @@
+package protectedby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/packages"
+)
+
+// synthSize is the size of a generated package.
+type synthSize struct {
+	structs int
+	// fields is the number of protected fields per struct.
+	fields int
+	// funcs is the number of methods per struct, half of them lock once and the other half lock on every access.
+	funcs int
+	// accesses is the number of protected field accesses per method.
+	accesses int
+}
+
+func (s synthSize) String() string {
+	return fmt.Sprintf("structs=%d/fields=%d/funcs=%d/accesses=%d", s.structs, s.fields, s.funcs, s.accesses)
+}
+
+// generatePackage writes a package of the given size to dir/src/name in GOPATH layout. Every access is protected, so
+// the analyzer reports nothing and the cost of the analysis itself is measured.
+func generatePackage(tb testing.TB, dir, name string, size synthSize) {
+	tb.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n\nimport \"sync\"\n", name)
+	for i := range size.structs {
+		fmt.Fprintf(&b, "\ntype s%d struct {\n", i)
+		for f := range size.fields {
+			fmt.Fprintf(&b, "\t// f%[1]d is protected by mu.\n\tf%[1]d map[int]int\n", f)
+		}
+		b.WriteString("\tmu sync.Mutex\n}\n")
+
+		for fn := range size.funcs {
+			relock := fn%2 == 1
+			fmt.Fprintf(&b, "\nfunc (s *s%d) m%d() {\n", i, fn)
+			if !relock {
+				b.WriteString("\ts.mu.Lock()\n\tdefer s.mu.Unlock()\n")
+			}
+			for a := range size.accesses {
+				field := 0
+				if size.fields > 0 {
+					field = a % size.fields
+				}
+				if relock {
+					b.WriteString("\ts.mu.Lock()\n")
+				}
+				if size.fields > 0 {
+					fmt.Fprintf(&b, "\ts.f%d[%d] = len(s.f%d)\n", field, a, field)
+				}
+				if relock {
+					b.WriteString("\ts.mu.Unlock()\n")
+				}
+			}
+			b.WriteString("}\n")
+		}
+	}
+
+	pkgDir := filepath.Join(dir, "src", name)
+	if err := os.MkdirAll(pkgDir, 0o755); err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pkgDir, name+".go"), []byte(b.String()), 0o644); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// loadPackages loads the packages from the GOPATH dir the same way analysistest does.
+func loadPackages(tb testing.TB, dir string, patterns ...string) []*packages.Package {
+	tb.Helper()
+
+	cfg := &packages.Config{
+		Mode: packages.LoadAllSyntax,
+		Dir:  dir,
+		Env:  append(os.Environ(), "GOPATH="+dir, "GO111MODULE=off", "GOPROXY=off"),
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		tb.Fatal("failed to load packages")
+	}
+
+	return pkgs
+}
+
+func runAnalyzer(tb testing.TB, pkgs []*packages.Package) []analysis.Diagnostic {
+	tb.Helper()
+
+	graph, err := checker.Analyze([]*analysis.Analyzer{Analyzer}, pkgs, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var res []analysis.Diagnostic
+	for act := range graph.All() {
+		if act.IsRoot && act.Analyzer == Analyzer {
+			if act.Err != nil {
+				tb.Fatal(act.Err)
+			}
+			res = append(res, act.Diagnostics...)
+		}
+	}
+
+	return res
+}
+
+func BenchmarkAnalyzer(b *testing.B) {
+	sizes := []synthSize{
+		{structs: 1, fields: 3, funcs: 2, accesses: 10},
+		{structs: 10, fields: 3, funcs: 4, accesses: 50},
+		{structs: 50, fields: 3, funcs: 2, accesses: 100},
+		{structs: 10, fields: 20, funcs: 10, accesses: 20},
+		{structs: 10, fields: 3, funcs: 2, accesses: 300},
+	}
+
+	for _, size := range sizes {
+		b.Run(size.String(), func(b *testing.B) {
+			dir := b.TempDir()
+			generatePackage(b, dir, "synth", size)
+			pkgs := loadPackages(b, dir, "synth")
+
+			b.ResetTimer()
+			for range b.N {
+				if diags := runAnalyzer(b, pkgs); len(diags) != 0 {
+					b.Fatalf("unexpected diagnostics: %v", diags[0].Message)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAccessesPerFunction grows the number of accesses per function. The time per access must stay roughly the
+// same, i.e. the analysis is linear in the size of a function.
+func BenchmarkAccessesPerFunction(b *testing.B) {
+	for _, accesses := range []int{250, 500, 1000, 2000} {
+		size := synthSize{structs: 1, fields: 3, funcs: 2, accesses: accesses}
+		b.Run(size.String(), func(b *testing.B) {
+			dir := b.TempDir()
+			generatePackage(b, dir, "synth", size)
+			pkgs := loadPackages(b, dir, "synth")
+
+			b.ResetTimer()
+			for range b.N {
+				if diags := runAnalyzer(b, pkgs); len(diags) != 0 {
+					b.Fatalf("unexpected diagnostics: %v", diags[0].Message)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*size.funcs*accesses), "ns/access")
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package protectedby
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// defaultBlockingFuncs are functions and methods that block, in the format of types.Func.FullName.
+var defaultBlockingFuncs = []string{
+	"time.Sleep",
+	"net/http.Get",
+	"net/http.Head",
+	"net/http.Post",
+	"net/http.PostForm",
+	"(*net/http.Client).Do",
+	"(*net/http.Client).Get",
+	"(*net/http.Client).Post",
+	"(*sync.WaitGroup).Wait",
+	"(net.Conn).Read",
+	"(net.Conn).Write",
+	"(*os/exec.Cmd).Run",
+	"(*os/exec.Cmd).Wait",
+}
+
+// checkBlockingOps reports calls of blocking functions, operations on unbuffered channels and select statements
+// without default performed while a lock that protects fields is held.
+func checkBlockingOps(r *runState, cfg *Config, m map[string]*protectedData) []*analysisError {
+	if !cfg.Blocking {
+		return nil
+	}
+
+	pass := r.pass
+	locks := make(map[*types.Var]bool)
+	for _, p := range m {
+		if obj, ok := pass.TypesInfo.Defs[p.lock.Names[0]].(*types.Var); ok {
+			locks[obj] = true
+		}
+	}
+	if len(locks) == 0 {
+		return nil
+	}
+
+	blocklist := make(map[string]bool)
+	for _, name := range cfg.blockingFuncs() {
+		blocklist[name] = true
+	}
+	unbuffered := unbufferedChans(pass)
+
+	var errors []*analysisError
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+
+			// acquired are the first acquisitions of distinct locks.
+			var acquired []ast.Expr
+			seen := make(map[lockKey]bool)
+			var ops []blockingOp
+			var visit func(n ast.Node) bool
+			visit = func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.FuncLit, *ast.GoStmt, *ast.DeferStmt:
+					return false
+				case *ast.SelectStmt:
+					if !hasDefault(n) {
+						ops = append(ops, blockingOp{pos: n.Pos(), desc: "select without default"})
+					}
+					// Channel operations of the select cases are a part of the select, only the case bodies are
+					// inspected.
+					for _, c := range n.Body.List {
+						for _, stmt := range c.(*ast.CommClause).Body {
+							ast.Inspect(stmt, visit)
+						}
+					}
+					return false
+				}
+
+				if lock := acquiredLock(n); lock != nil && isAnnotatedLock(pass, lock, locks) {
+					if key := r.exprKey(lock); key != noKey && !seen[key] {
+						seen[key] = true
+						acquired = append(acquired, lock)
+					}
+					return true
+				}
+				if op, ok := blockingOperation(pass, n, blocklist, unbuffered, locks); ok {
+					ops = append(ops, op)
+				}
+
+				return true
+			}
+			ast.Inspect(fn.Body, visit)
+
+			for _, op := range ops {
+				s := site{file: file, fn: fn, pos: op.pos, locks: r.lockState(fn)}
+				for _, lock := range acquired {
+					if lock.Pos() >= op.pos {
+						break
+					}
+					if !isLockHeld(s, keyRef(r.exprKey(lock)), false) {
+						continue
+					}
+
+					errors = append(errors, &analysisError{
+						msg:      fmt.Sprintf("blocking %s while holding %s", op.desc, types.ExprString(lock)),
+						pos:      op.pos,
+						category: categoryBlocking,
+						related: []analysis.RelatedInformation{{
+							Pos:     lock.Pos(),
+							End:     lock.End(),
+							Message: fmt.Sprintf("%s acquired here", types.ExprString(lock)),
+						}},
+					})
+					break
+				}
+			}
+		}
+	}
+
+	return errors
+}
+
+// blockingOp is an operation that can block the goroutine, desc describes it in diagnostics.
+type blockingOp struct {
+	pos  token.Pos
+	desc string
+}
+
+func blockingOperation(
+	pass *analysis.Pass, n ast.Node, blocklist map[string]bool, unbuffered map[types.Object]bool,
+	locks map[*types.Var]bool,
+) (blockingOp, bool) {
+	var ch ast.Expr
+	var desc string
+	switch n := n.(type) {
+	case *ast.CallExpr:
+		fn, ok := typeutil.Callee(pass.TypesInfo, n).(*types.Func)
+		if !ok || !blocklist[fn.Origin().FullName()] {
+			return blockingOp{}, false
+		}
+		return blockingOp{pos: n.Pos(), desc: "call to " + fn.FullName()}, true
+	case *ast.SendStmt:
+		ch, desc = n.Chan, "send to unbuffered channel "
+	case *ast.UnaryExpr:
+		if n.Op != token.ARROW {
+			return blockingOp{}, false
+		}
+		ch, desc = n.X, "receive from unbuffered channel "
+	case *ast.RangeStmt:
+		if _, ok := pass.TypesInfo.TypeOf(n.X).Underlying().(*types.Chan); !ok {
+			return blockingOp{}, false
+		}
+		ch, desc = n.X, "range over unbuffered channel "
+	default:
+		return blockingOp{}, false
+	}
+
+	// Channels used as locks are acquired and released, not blocked on.
+	if isAnnotatedLock(pass, ch, locks) {
+		return blockingOp{}, false
+	}
+	obj := chanObject(pass, ch)
+	if obj == nil || !unbuffered[obj] {
+		return blockingOp{}, false
+	}
+
+	return blockingOp{pos: n.Pos(), desc: desc + types.ExprString(ch)}, true
+}
+
+func hasDefault(s *ast.SelectStmt) bool {
+	for _, c := range s.Body.List {
+		if cc, ok := c.(*ast.CommClause); ok && cc.Comm == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAnnotatedLock reports whether the expression selects one of the locks that protect fields.
+func isAnnotatedLock(pass *analysis.Pass, expr ast.Expr, locks map[*types.Var]bool) bool {
+	se, ok := ast.Unparen(expr).(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	v, ok := pass.TypesInfo.ObjectOf(se.Sel).(*types.Var)
+	return ok && locks[v.Origin()]
+}
+
+// chanObject returns the variable or the field the channel expression refers to.
+func chanObject(pass *analysis.Pass, expr ast.Expr) types.Object {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.Ident:
+		return pass.TypesInfo.ObjectOf(e)
+	case *ast.SelectorExpr:
+		if v, ok := pass.TypesInfo.ObjectOf(e.Sel).(*types.Var); ok {
+			return v.Origin()
+		}
+	}
+
+	return nil
+}
+
+// unbufferedChans returns variables and fields of channel types mapped to true if they are only assigned unbuffered
+// channels made in the package, e.g. ch := make(chan int), s.ch = make(chan int, 0) or &T{ch: make(chan int)}.
+func unbufferedChans(pass *analysis.Pass) map[types.Object]bool {
+	res := make(map[types.Object]bool)
+	for obj, values := range chanAssigns(pass) {
+		res[obj] = true
+		for _, v := range values {
+			// A channel assigned from elsewhere can be buffered.
+			if capacity, _ := makeChanCap(pass, v); capacity == nil || constant.Sign(capacity) != 0 {
+				res[obj] = false
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+// chanAssigns returns the values assigned to variables and fields of channel types in the package, including
+// composite literal fields.
+func chanAssigns(pass *analysis.Pass) map[types.Object][]ast.Expr {
+	res := make(map[types.Object][]ast.Expr)
+	assign := func(obj types.Object, rhs ast.Expr) {
+		if obj == nil {
+			return
+		}
+		if _, ok := obj.Type().Underlying().(*types.Chan); !ok {
+			return
+		}
+		if v, ok := obj.(*types.Var); ok {
+			obj = v.Origin()
+		}
+		res[obj] = append(res[obj], rhs)
+	}
+
+	for _, file := range pass.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if len(n.Lhs) != len(n.Rhs) {
+					return true
+				}
+				for i := range n.Lhs {
+					assign(chanObject(pass, n.Lhs[i]), n.Rhs[i])
+				}
+			case *ast.ValueSpec:
+				if len(n.Names) != len(n.Values) {
+					return true
+				}
+				for i := range n.Names {
+					assign(pass.TypesInfo.ObjectOf(n.Names[i]), n.Values[i])
+				}
+			case *ast.KeyValueExpr:
+				if key, ok := n.Key.(*ast.Ident); ok {
+					if v, ok := pass.TypesInfo.ObjectOf(key).(*types.Var); ok && v.IsField() {
+						assign(v, n.Value)
+					}
+				}
+			}
+
+			return true
+		})
+	}
+
+	return res
+}
+
+// makeChanCap reports whether the expression makes a channel and returns its capacity, or nil if the capacity is not
+// a constant.
+func makeChanCap(pass *analysis.Pass, expr ast.Expr) (capacity constant.Value, ok bool) {
+	call, ok := ast.Unparen(expr).(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return nil, false
+	}
+	id, ok := ast.Unparen(call.Fun).(*ast.Ident)
+	if !ok {
+		return nil, false
+	}
+	if b, ok := pass.TypesInfo.ObjectOf(id).(*types.Builtin); !ok || b.Name() != "make" {
+		return nil, false
+	}
+	if _, ok := pass.TypesInfo.TypeOf(call.Args[0]).Underlying().(*types.Chan); !ok {
+		return nil, false
+	}
+	if len(call.Args) == 1 {
+		return constant.MakeInt64(0), true
+	}
+
+	return pass.TypesInfo.Types[call.Args[1]].Value, true
+}
@@ -0,0 +1,110 @@
+package protectedby
+
+// Category describes a kind of diagnostics of the analyzer. The ID is the category of analysis.Diagnostic.
+type Category struct {
+	ID string
+	// Short is a one sentence description of the problem.
+	Short string
+	// Help explains the problem and how to fix it.
+	Help string
+}
+
+// categories are the diagnostic categories in a stable order, e.g. the order of SARIF rules.
+var categories = []Category{
+	{
+		ID:    categoryUnprotectedAccess,
+		Short: "Access to a protected field without holding its lock.",
+		Help: "A field annotated with \"protected by <lock>\" is accessed while the lock is not held. Acquire the " +
+			"lock with Lock() before the access and release it after, e.g. with defer.",
+	},
+	{
+		ID:    categoryExportedField,
+		Short: "Protected field is exported.",
+		Help: "Accesses to an exported field from other packages cannot be checked. Unexport the field and " +
+			"provide methods that acquire the lock.",
+	},
+	{
+		ID:    categoryExportedMutex,
+		Short: "Lock that protects fields is exported.",
+		Help: "Other packages can acquire or release an exported lock behind the back of the struct methods. " +
+			"Unexport the lock.",
+	},
+	{
+		ID:    categoryLockNotLocker,
+		Short: "Lock does not implement sync.Locker.",
+		Help: "The field named in the annotation must implement sync.Locker, e.g. sync.Mutex or sync.RWMutex, or " +
+			"be a channel used as a lock.",
+	},
+	{
+		ID:    categoryUnknownLock,
+		Short: "Annotation refers to a lock that does not exist.",
+		Help: "The lock named in the annotation is not a field of the struct that declares the annotated field, " +
+			"nor of the structs enclosing it. Fix the lock name.",
+	},
+	{
+		ID:    categoryAnnotationParseError,
+		Short: "Annotation cannot be parsed.",
+		Help: "The annotation phrase is found but cannot be parsed, e.g. \"protected by\" appears more than once " +
+			"or is not followed by a lock name. Fix the comment or reword it if it is not meant as an annotation.",
+	},
+	{
+		ID:    categoryInvalidAnnotation,
+		Short: "Annotation does not apply to the field.",
+		Help: "The annotation is well-formed but cannot be applied, e.g. \"accessed atomically\" on a field that " +
+			"sync/atomic cannot access.",
+	},
+	{
+		ID:    categoryUsageOutsideFunction,
+		Short: "Protected field is used outside of a function.",
+		Help:  "Accesses to annotated fields are checked within functions only, e.g. not in package variables.",
+	},
+	{
+		ID:    categoryEscapingReference,
+		Short: "Reference to a protected field escapes the critical section.",
+		Help: "The address of a protected field or a copy of a slice or map field is returned, stored, captured, " +
+			"passed to a function or used after the lock is released. Copy the data while holding the lock instead.",
+	},
+	{
+		ID:    categoryUnprotectedCall,
+		Short: "Call that requires a lock is made without holding it.",
+		Help: "The function is annotated with \"called with <lock> held\", or is sync.Cond.Wait of a condition " +
+			"associated with the lock. Acquire the lock before the call.",
+	},
+	{
+		ID:    categoryNonAtomicAccess,
+		Short: "Field accessed atomically is accessed without sync/atomic.",
+		Help:  "A field annotated with \"accessed atomically\" must be accessed with sync/atomic only.",
+	},
+	{
+		ID:    categoryImmutableWrite,
+		Short: "Write to an immutable field outside of its constructor.",
+		Help:  "A field annotated as immutable or read-only after init is only written when the value is created.",
+	},
+	{
+		ID:    categoryConfinedAccess,
+		Short: "Access to a confined field from another goroutine.",
+		Help: "A field annotated with \"confined to <function>\" is only accessed from the function and the " +
+			"functions it calls.",
+	},
+	{
+		ID:    categoryLockOrder,
+		Short: "Locks acquired in an inconsistent order.",
+		Help: "Acquiring locks in different orders can deadlock. Follow the declared order or the order used in " +
+			"the rest of the code.",
+	},
+	{
+		ID:    categoryBlocking,
+		Short: "Blocking operation performed while holding a lock.",
+		Help:  "Blocking while holding a lock that protects fields stalls other goroutines. Release the lock first.",
+	},
+	{
+		ID:    categoryProtectedCopy,
+		Short: "Struct with protected fields copied by value.",
+		Help:  "The copied fields are not synchronized with the original ones. Use a pointer instead.",
+	},
+}
+
+// Categories returns the diagnostic categories of the analyzer in a stable order.
+func Categories() []Category {
+	return append([]Category(nil), categories...)
+}
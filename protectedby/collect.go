@@ -0,0 +1,203 @@
+package protectedby
+
+import (
+	"cmp"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// fieldNode is a struct field declaration together with the path from its struct type up to the file, innermost
+// first, and the comment groups associated with the field, see fieldComments.
+type fieldNode struct {
+	file     *ast.File
+	field    *ast.Field
+	path     []ast.Node
+	comments []*ast.CommentGroup
+}
+
+// fieldSelection is a selection of a struct field in a function, i.e. a usage of the field if it is annotated.
+type fieldSelection struct {
+	*usage
+	obj *types.Var
+}
+
+// callSite is a call in a function declared in the package.
+type callSite struct {
+	call *ast.CallExpr
+	site
+}
+
+// collected holds the nodes of the package gathered in a single traversal: field declarations, field selections,
+// calls in functions and lock states of functions, see funcLockState.
+type collected struct {
+	fields     []*fieldNode
+	selections []*fieldSelection
+	calls      []*callSite
+	locks      map[*ast.FuncDecl]*funcLockState
+}
+
+var collectedTypes = []ast.Node{
+	(*ast.StructType)(nil),
+	(*ast.SelectorExpr)(nil),
+	(*ast.CallExpr)(nil),
+	(*ast.SendStmt)(nil),
+	(*ast.UnaryExpr)(nil),
+	(*ast.IfStmt)(nil),
+	(*ast.ForStmt)(nil),
+	(*ast.AssignStmt)(nil),
+	(*ast.ValueSpec)(nil),
+}
+
+// collect traverses the package once.
+func collect(pass *analysis.Pass) *collected {
+	ins := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	res := &collected{locks: make(map[*ast.FuncDecl]*funcLockState)}
+
+	ins.WithStack(collectedTypes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		file := stack[0].(*ast.File)
+
+		var fn *ast.FuncDecl
+		var deferStmt *ast.DeferStmt
+		for _, p := range stack {
+			switch p := p.(type) {
+			case *ast.FuncDecl:
+				fn = p
+			case *ast.DeferStmt:
+				if deferStmt == nil {
+					deferStmt = p
+				}
+			}
+		}
+
+		var st *funcLockState
+		if fn != nil {
+			st = res.locks[fn]
+			if st == nil {
+				st = &funcLockState{}
+				res.locks[fn] = st
+			}
+			st.addNode(n, stack)
+		}
+
+		switch n := n.(type) {
+		case *ast.StructType:
+			path := reversePath(stack)
+			comments := fieldComments(pass.Fset, file, n.Fields)
+			for _, f := range n.Fields.List {
+				res.fields = append(res.fields, &fieldNode{
+					file:     file,
+					field:    f,
+					path:     path,
+					comments: comments[f],
+				})
+			}
+		case *ast.SelectorExpr:
+			if s := fieldSelectionOf(pass, n); s != nil {
+				s.file = file
+				s.enclosingFunc = fn
+				s.deferStmt = deferStmt
+				s.locks = st
+				s.path = reversePath(stack)
+				res.selections = append(res.selections, s)
+			}
+		case *ast.CallExpr:
+			if fn != nil {
+				res.calls = append(res.calls, &callSite{
+					call: n,
+					site: site{file: file, fn: fn, deferStmt: deferStmt, pos: n.Pos(), locks: st},
+				})
+			}
+		}
+
+		return true
+	})
+
+	return res
+}
+
+// fieldSelectionOf returns the selection if the selector is a chain of field selections, e.g. s.stats.hits. Fields of
+// generic struct instantiations, aliases and promoted fields of embedded structs are matched by the origin field
+// declaration.
+func fieldSelectionOf(pass *analysis.Pass, se *ast.SelectorExpr) *fieldSelection {
+	id := rootIdent(pass, se.X)
+	if id == nil {
+		return nil
+	}
+	sel, ok := pass.TypesInfo.Selections[se]
+	if !ok || sel.Kind() != types.FieldVal {
+		return nil
+	}
+	fieldVar, ok := sel.Obj().(*types.Var)
+	if !ok {
+		return nil
+	}
+
+	return &fieldSelection{
+		usage: &usage{
+			selector:    se,
+			selectorXID: id,
+		},
+		obj: fieldVar.Origin(),
+	}
+}
+
+// fieldComments associates comment groups inside the field list with the fields the same way ast.CommentMap does
+// without building the map for the whole file. A comment group belongs to the previous field if it starts on the same
+// line the field ends, or on the next line followed by an empty line. Otherwise, it belongs to the next field.
+func fieldComments(fset *token.FileSet, file *ast.File, list *ast.FieldList) map[*ast.Field][]*ast.CommentGroup {
+	res := make(map[*ast.Field][]*ast.CommentGroup)
+	line := func(pos token.Pos) int {
+		return fset.Position(pos).Line
+	}
+
+	// Comment groups are sorted by position, skip the ones before the list.
+	i, _ := slices.BinarySearchFunc(file.Comments, list.Opening, func(cg *ast.CommentGroup, pos token.Pos) int {
+		return cmp.Compare(cg.Pos(), pos)
+	})
+	next := 0
+	for ; i < len(file.Comments) && file.Comments[i].Pos() < list.Closing; i++ {
+		cg := file.Comments[i]
+		for next < len(list.List) && list.List[next].Pos() < cg.Pos() {
+			next++
+		}
+		var prevField, nextField *ast.Field
+		if next > 0 {
+			prevField = list.List[next-1]
+			// The comment is inside the field, e.g. in a nested struct type.
+			if cg.Pos() < prevField.End() {
+				continue
+			}
+		}
+		nextLine := line(list.Closing)
+		if next < len(list.List) {
+			nextField = list.List[next]
+			nextLine = line(nextField.Pos())
+		}
+
+		switch {
+		case prevField != nil && line(cg.Pos()) == line(prevField.End()):
+			res[prevField] = append(res[prevField], cg)
+		case prevField != nil && line(cg.Pos()) == line(prevField.End())+1 && nextLine > line(cg.End())+1:
+			res[prevField] = append(res[prevField], cg)
+		case nextField != nil:
+			res[nextField] = append(res[nextField], cg)
+		}
+	}
+
+	return res
+}
+
+func reversePath(stack []ast.Node) []ast.Node {
+	path := slices.Clone(stack)
+	slices.Reverse(path)
+	return path
+}
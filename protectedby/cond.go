@@ -0,0 +1,246 @@
+package protectedby
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+const associatedWith = "associated with "
+
+// condLocks maps sync.Cond fields to the lock fields of the same struct they are associated with, i.e. the lock that
+// is cond.L. Conditions are associated with locks either by the "associated with <lock>" annotation or by
+// sync.NewCond(&s.mu) calls in the package.
+type condLocks map[*types.Var]*types.Var
+
+// getCondLock returns the lock the sync.Cond field is associated with by the annotation. The phrase is not an
+// annotation on other fields, e.g. "user is the account associated with this session", see parseComments.
+func getCondLock(pass *analysis.Pass, st *structInfo, c *ast.Comment) (*types.Var, *analysisError) {
+	text := annotationText(c)
+	idx := phraseIndex(strings.ToLower(text), associatedWith)
+	names := strings.FieldsFunc(text[idx+len(associatedWith):], isLetterOrNumber)
+	if len(names) == 0 {
+		return nil, &analysisError{
+			msg:      fmt.Sprintf("failed to parse lock name from comment %q", text),
+			pos:      c.Pos(),
+			category: categoryAnnotationParseError,
+		}
+	}
+
+	lock := getStructFieldByName(names[0], st.types[0])
+	if lock == nil {
+		return nil, &analysisError{
+			msg:      fmt.Sprintf("struct %q does not have lock field %q", st.name, names[0]),
+			pos:      c.Pos(),
+			category: categoryUnknownLock,
+		}
+	}
+	if !implementsLocker(pass, lock) {
+		return nil, &analysisError{
+			msg:      fmt.Sprintf("lock %s doesn't implement sync.Locker interface", names[0]),
+			pos:      lock.Pos(),
+			category: categoryLockNotLocker,
+			related:  []analysis.RelatedInformation{annotationInfo(c, "%s referenced here", names[0])},
+		}
+	}
+
+	obj, _ := pass.TypesInfo.Defs[lock.Names[0]].(*types.Var)
+	return obj, nil
+}
+
+func isSyncCond(typ types.Type) bool {
+	named, ok := types.Unalias(deref(typ)).(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == "sync" && obj.Name() == "Cond"
+}
+
+// findCondLocks adds conditions created with sync.NewCond in the package, e.g. s.cond = sync.NewCond(&s.mu) or
+// &T{cond: sync.NewCond(&mu)}, to the annotated ones. The lock must be a field of the struct that declares the
+// condition.
+func findCondLocks(pass *analysis.Pass, annotated condLocks) condLocks {
+	res := make(condLocks, len(annotated))
+	for cond, lock := range annotated {
+		res[cond] = lock
+	}
+
+	add := func(lhs, rhs ast.Expr) {
+		var cond *types.Var
+		switch e := ast.Unparen(lhs).(type) {
+		case *ast.SelectorExpr:
+			cond, _ = pass.TypesInfo.ObjectOf(e.Sel).(*types.Var)
+		case *ast.Ident:
+			cond, _ = pass.TypesInfo.ObjectOf(e).(*types.Var)
+		}
+		if cond == nil || !cond.IsField() {
+			return
+		}
+		cond = cond.Origin()
+		if _, ok := res[cond]; ok {
+			return
+		}
+
+		call, ok := ast.Unparen(rhs).(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return
+		}
+		fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+		if !ok || fn.FullName() != "sync.NewCond" {
+			return
+		}
+
+		arg := ast.Unparen(call.Args[0])
+		if u, ok := arg.(*ast.UnaryExpr); ok && u.Op == token.AND {
+			arg = ast.Unparen(u.X)
+		}
+		sel, ok := arg.(*ast.SelectorExpr)
+		if !ok {
+			return
+		}
+		lock, ok := pass.TypesInfo.ObjectOf(sel.Sel).(*types.Var)
+		if !ok || !lock.IsField() || !isSameStructField(cond, lock) {
+			return
+		}
+		res[cond] = lock.Origin()
+	}
+
+	for _, file := range pass.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if len(n.Lhs) != len(n.Rhs) {
+					return true
+				}
+				for i := range n.Lhs {
+					add(n.Lhs[i], n.Rhs[i])
+				}
+			case *ast.KeyValueExpr:
+				add(n.Key, n.Value)
+			}
+
+			return true
+		})
+	}
+
+	return res
+}
+
+// isSameStructField reports whether both fields are declared in the same struct type.
+func isSameStructField(f1, f2 *types.Var) bool {
+	f1, f2 = f1.Origin(), f2.Origin()
+	if f1.Pkg() != f2.Pkg() {
+		return false
+	}
+
+	for _, name := range f1.Pkg().Scope().Names() {
+		tn, ok := f1.Pkg().Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		st, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		var found1, found2 bool
+		for i := range st.NumFields() {
+			found1 = found1 || st.Field(i) == f1
+			found2 = found2 || st.Field(i) == f2
+		}
+		if found1 && found2 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// condLock returns the lock field of the struct the expression is selected from if the expression is the locker of
+// a condition, e.g. s.mu for s.cond.L, or nil otherwise.
+func (r *runState) condLock(e *ast.SelectorExpr) (ast.Expr, *types.Var) {
+	pass := r.pass
+	v, ok := pass.TypesInfo.ObjectOf(e.Sel).(*types.Var)
+	if !ok || !v.IsField() || v.Name() != "L" || !isSyncCond(pass.TypesInfo.TypeOf(e.X)) {
+		return nil, nil
+	}
+	cond, ok := ast.Unparen(e.X).(*ast.SelectorExpr)
+	if !ok {
+		return nil, nil
+	}
+	condVar, ok := pass.TypesInfo.ObjectOf(cond.Sel).(*types.Var)
+	if !ok {
+		return nil, nil
+	}
+	lock, ok := r.conds[condVar.Origin()]
+	if !ok {
+		return nil, nil
+	}
+
+	return cond.X, lock
+}
+
+// checkCondWaits reports cond.Wait() calls made without holding the lock associated with the condition. Wait releases
+// the lock and acquires it again before returning, so protected fields can be accessed after Wait.
+func checkCondWaits(r *runState, calls []*callSite, preconds preconditions) []*analysisError {
+	pass, locks := r.pass, r.conds
+	if len(locks) == 0 {
+		return nil
+	}
+
+	var errors []*analysisError
+	for _, c := range calls {
+		fn, ok := typeutil.Callee(pass.TypesInfo, c.call).(*types.Func)
+		if !ok || fn.FullName() != "(*sync.Cond).Wait" {
+			continue
+		}
+		sel, ok := ast.Unparen(c.call.Fun).(*ast.SelectorExpr)
+		if !ok {
+			continue
+		}
+		cond, ok := ast.Unparen(sel.X).(*ast.SelectorExpr)
+		if !ok {
+			continue
+		}
+		condVar, ok := pass.TypesInfo.ObjectOf(cond.Sel).(*types.Var)
+		if !ok {
+			continue
+		}
+		lock, ok := locks[condVar.Origin()]
+		if !ok {
+			continue
+		}
+		baseKey := r.exprKey(cond.X)
+		if baseKey == noKey {
+			continue
+		}
+
+		expected := r.key(baseKey, lock)
+		ref := lockRef{keys: c.locks.aliasesBefore(c.pos).class(expected)}
+		if isLockHeld(c.site, ref, preconds.heldOnEntry(r, c.fn, ref.matchesKey)) {
+			continue
+		}
+
+		related := []analysis.RelatedInformation{{
+			Pos:     lock.Pos(),
+			Message: fmt.Sprintf("lock %s associated with %s declared here", lock.Name(), cond.Sel.Name),
+		}}
+		if op := findOffendingRelease(c.site, ref); op != nil {
+			related = append(related, releaseInfo(op))
+		}
+		errors = append(errors, &analysisError{
+			msg: fmt.Sprintf("not protected call to %s.Wait, use %s.%s.Lock()",
+				types.ExprString(cond), types.ExprString(cond.X), lock.Name()),
+			pos:      c.call.Pos(),
+			category: categoryUnprotectedCall,
+			related:  related,
+		})
+	}
+
+	return errors
+}
@@ -0,0 +1,209 @@
+package protectedby
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+)
+
+// Config configures the analyzer created by NewAnalyzer. The zero value is the configuration of Analyzer. The json
+// names are the setting names of the golangci-lint plugin.
+type Config struct {
+	// StopAfterErrors skips the remaining checks of a package once annotations of the package are reported as
+	// malformed, e.g. a lock that does not exist. By default, all checks run.
+	StopAfterErrors bool `json:"stop-after-errors"`
+	// ProtectedBy are the phrases that introduce the lock name in a field comment, e.g. "guarded by". The phrases
+	// are matched case-insensitively. Defaults to "protected by".
+	ProtectedBy []string `json:"protected-by"`
+	// AllowExported allows exported protected fields and exported locks. Only accesses within the declaring package
+	// are checked.
+	AllowExported bool `json:"allow-exported"`
+	// Suppress are annotated fields that are not checked, in the form of the package path followed by the struct and
+	// the field name, e.g. "example.com/cache.Cache.items".
+	Suppress []string `json:"suppress"`
+	// Blocking enables reporting of blocking operations performed while holding a lock that protects fields.
+	Blocking bool `json:"blocking"`
+	// BlockingFuncs are the functions reported as blocking in the format of types.Func.FullName, e.g.
+	// "(*sync.WaitGroup).Wait". Defaults to defaultBlockingFuncs.
+	BlockingFuncs []string `json:"blocking-funcs"`
+	// Severity is the level of diagnostics by category, e.g. {"blocking-while-locked": "warning"}. Diagnostics of
+	// categories that are not listed are errors. The analyzer reports all diagnostics the same way, the levels are
+	// used by the SARIF and the text output of the command.
+	Severity Severity `json:"severity"`
+}
+
+// Diagnostic levels of Severity, the same as the SARIF result levels.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelNote    = "note"
+)
+
+// Severity maps diagnostic categories to levels.
+type Severity map[string]string
+
+// Level returns the level of diagnostics of the category.
+func (s Severity) Level(category string) string {
+	if l, ok := s[category]; ok {
+		return l
+	}
+
+	return LevelError
+}
+
+func (s Severity) validate() error {
+	for category, l := range s {
+		switch l {
+		case LevelError, LevelWarning, LevelNote:
+		default:
+			return fmt.Errorf("invalid level %q of category %q, expected %s, %s or %s",
+				l, category, LevelError, LevelWarning, LevelNote)
+		}
+	}
+
+	return nil
+}
+
+// SeverityOf returns the severity of the analyzer created by NewAnalyzer, including the changes made by its flags.
+func SeverityOf(a *analysis.Analyzer) Severity {
+	f := a.Flags.Lookup("severity")
+	if f == nil {
+		return nil
+	}
+	s, _ := f.Value.(*severityFlag)
+	if s == nil {
+		return nil
+	}
+
+	return Severity(*s)
+}
+
+// Analyzer is the analyzer with the default configuration.
+var Analyzer = NewAnalyzer(Config{})
+
+// NewAnalyzer returns an analyzer with the given configuration. The configuration can be changed further by the
+// analyzer flags.
+func NewAnalyzer(cfg Config) *analysis.Analyzer {
+	c := &cfg
+	c.ProtectedBy = append([]string(nil), c.ProtectedBy...)
+	c.Suppress = append([]string(nil), c.Suppress...)
+	c.BlockingFuncs = append([]string(nil), c.BlockingFuncs...)
+	c.Severity = maps.Clone(c.Severity)
+
+	a := &analysis.Analyzer{
+		Name:       "protectedby",
+		Doc:        "Checks that access to shared resources is protected.",
+		Run:        c.run,
+		Requires:   []*analysis.Analyzer{inspect.Analyzer},
+		ResultType: reflect.TypeOf(new(Coverage)),
+		FactTypes:  []analysis.Fact{new(lockPreconditions), new(lockOrder), new(acquiredLocks)},
+	}
+	a.Flags.BoolVar(&c.StopAfterErrors, "stop-after-errors", c.StopAfterErrors,
+		"skip the remaining checks of a package with malformed annotations")
+	a.Flags.Var((*listFlag)(&c.ProtectedBy), "protected-by",
+		fmt.Sprintf("comma-separated list of phrases that introduce the lock name (default %q)", defaultProtectedBy))
+	a.Flags.BoolVar(&c.AllowExported, "allow-exported", c.AllowExported,
+		"allow exported protected fields and exported locks")
+	a.Flags.Var((*listFlag)(&c.Suppress), "suppress",
+		"comma-separated list of fields that are not checked, e.g. example.com/cache.Cache.items")
+	a.Flags.BoolVar(&c.Blocking, "blocking", c.Blocking,
+		"report blocking operations performed while holding a lock that protects fields")
+	a.Flags.Var((*listFlag)(&c.BlockingFuncs), "blocking-funcs",
+		fmt.Sprintf("comma-separated list of blocking functions (default %q)", strings.Join(defaultBlockingFuncs, ",")))
+	a.Flags.Var((*severityFlag)(&c.Severity), "severity",
+		"comma-separated list of category=level pairs, the level is error, warning or note")
+
+	return a
+}
+
+// protectedByPatterns returns the lower case phrases that introduce the lock name followed by a space, e.g.
+// "protected by ".
+func (c *Config) protectedByPatterns() []string {
+	phrases := c.ProtectedBy
+	if len(phrases) == 0 {
+		phrases = []string{defaultProtectedBy}
+	}
+
+	res := make([]string, 0, len(phrases))
+	for _, p := range phrases {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			res = append(res, p+" ")
+		}
+	}
+
+	return res
+}
+
+func (c *Config) blockingFuncs() []string {
+	if len(c.BlockingFuncs) == 0 {
+		return defaultBlockingFuncs
+	}
+
+	return c.BlockingFuncs
+}
+
+// listFlag is a comma-separated list flag.
+type listFlag []string
+
+var _ flag.Value = (*listFlag)(nil)
+
+func (f *listFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(s string) error {
+	*f = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f = append(*f, v)
+		}
+	}
+
+	return nil
+}
+
+// severityFlag is a comma-separated list of category=level pairs.
+type severityFlag Severity
+
+var _ flag.Value = (*severityFlag)(nil)
+
+func (f *severityFlag) String() string {
+	if f == nil {
+		return ""
+	}
+
+	var pairs []string
+	for _, category := range slices.Sorted(maps.Keys(*f)) {
+		pairs = append(pairs, category+"="+(*f)[category])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f *severityFlag) Set(s string) error {
+	res := make(Severity)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		category, level, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid severity %q, expected category=level", pair)
+		}
+		res[strings.TrimSpace(category)] = strings.TrimSpace(level)
+	}
+	if err := res.validate(); err != nil {
+		return err
+	}
+
+	*f = severityFlag(res)
+	return nil
+}
@@ -0,0 +1,198 @@
+package protectedby
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/static"
+	"golang.org/x/tools/go/ssa"
+)
+
+// confinedData is a field annotated with "confined to <function>". Such a field can only be accessed by a single
+// goroutine running the function, i.e. from the function itself and the functions it calls statically.
+type confinedData struct {
+	*fieldData
+	// owner is the function name as written in the annotation, e.g. "(*conn).readLoop".
+	owner string
+}
+
+// getConfinedData returns the confined field or nil if the word after "confined to" is not a function of the package,
+// e.g. "deadline is confined to the range set by the server". Such a comment is prose rather than an annotation.
+func getConfinedData(
+	pass *analysis.Pass, st *structInfo, field *ast.Field, c *ast.Comment,
+) (*confinedData, *analysisError) {
+	text := annotationText(c)
+	idx := phraseIndex(strings.ToLower(text), confinedTo)
+	if idx == -1 {
+		return nil, nil
+	}
+	words := strings.Fields(text[idx+len(confinedTo):])
+	if len(words) == 0 {
+		return nil, nil
+	}
+	owner := strings.Trim(words[0], "\"`'.,;:")
+	if lookupFunc(pass.Pkg, owner) == nil {
+		return nil, nil
+	}
+
+	fieldName := getFieldName(field)
+	if token.IsExported(fieldName) {
+		return nil, &analysisError{
+			msg:      fmt.Sprintf("exported confined field %s.%s", st.name, fieldName),
+			pos:      field.Pos(),
+			category: categoryExportedField,
+		}
+	}
+
+	return &confinedData{
+		fieldData: newFieldData(pass, st, field, c),
+		owner:     owner,
+	}, nil
+}
+
+// lookupFunc returns the package level function or method with the given name, e.g. "readLoop", "conn.readLoop" or
+// "(*conn).readLoop", or nil if the package does not declare it.
+func lookupFunc(pkg *types.Package, name string) *types.Func {
+	recv, method, isMethod := strings.Cut(normalizeFuncName(name), ".")
+	if !isMethod {
+		fn, _ := pkg.Scope().Lookup(recv).(*types.Func)
+		return fn
+	}
+
+	tn, ok := pkg.Scope().Lookup(recv).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(tn.Type()), false, pkg, method)
+	fn, _ := obj.(*types.Func)
+
+	return fn
+}
+
+// checkConfinedAccess reports accesses to confined fields from functions that are not reachable from the owner
+// function in the static call graph of the package. Functions started with the go statement are not considered
+// reachable since they run in another goroutine.
+func checkConfinedAccess(r *runState, m map[string]*confinedData) []*analysisError {
+	if len(m) == 0 {
+		return nil
+	}
+
+	pass := r.pass
+	ssaInfo := r.buildSSA()
+	if ssaInfo == nil {
+		return nil
+	}
+	cg := static.CallGraph(ssaInfo.pkg.Prog)
+
+	var errors []*analysisError
+	for _, d := range m {
+		// The owner is declared in the package, see getConfinedData, but its SSA function can be missing, e.g. for
+		// generic functions.
+		owner := findSSAFunction(ssaInfo.srcFuncs, d.owner)
+		if owner == nil {
+			continue
+		}
+
+		reachable := reachableFrom(cg, owner)
+		for _, u := range d.usages {
+			fn := ssaInfo.enclosingFunction(u.path)
+			if fn == nil || reachable[fn] {
+				continue
+			}
+			// The function that allocated the value owns it until the value is published.
+			if r.isAllocatedIn(u.selectorXID, u.enclosingFunc) {
+				continue
+			}
+
+			errors = append(errors, &analysisError{
+				msg: fmt.Sprintf("access to field %s confined to %s from %s",
+					getFieldName(d.field), d.owner, fn.RelString(pass.Pkg)),
+				pos:      u.selectorXID.Pos(),
+				category: categoryConfinedAccess,
+				related:  d.evidence(),
+			})
+		}
+	}
+
+	return errors
+}
+
+// findSSAFunction returns the package level function or method with the given name. Methods can be referred to with
+// either pointer or value receivers, i.e. both "(*T).m" and "T.m" refer to the same method.
+func findSSAFunction(funcs []*ssa.Function, name string) *ssa.Function {
+	name = normalizeFuncName(name)
+	for _, fn := range funcs {
+		if fn.Parent() != nil {
+			continue
+		}
+		if normalizeFuncName(fn.RelString(fn.Pkg.Pkg)) == name {
+			return fn
+		}
+	}
+
+	return nil
+}
+
+func normalizeFuncName(name string) string {
+	return strings.NewReplacer("(", "", ")", "", "*", "").Replace(name)
+}
+
+// reachableFrom returns the set of functions that can be called from the root function in the same goroutine.
+func reachableFrom(cg *callgraph.Graph, root *ssa.Function) map[*ssa.Function]bool {
+	res := map[*ssa.Function]bool{root: true}
+	queue := []*ssa.Function{root}
+	for len(queue) > 0 {
+		fn := queue[0]
+		queue = queue[1:]
+
+		var callees []*ssa.Function
+		if node := cg.Nodes[fn]; node != nil {
+			for _, e := range node.Out {
+				if _, isGo := e.Site.(*ssa.Go); !isGo {
+					callees = append(callees, e.Callee.Func)
+				}
+			}
+		}
+		// Function literals are not necessarily called statically, e.g. when passed as callbacks, but their bodies
+		// still run on behalf of the enclosing function unless started in a separate goroutine.
+		for _, anon := range fn.AnonFuncs {
+			if !isStartedAsGoroutine(fn, anon) {
+				callees = append(callees, anon)
+			}
+		}
+
+		for _, callee := range callees {
+			if !res[callee] {
+				res[callee] = true
+				queue = append(queue, callee)
+			}
+		}
+	}
+
+	return res
+}
+
+// isStartedAsGoroutine reports whether the anonymous function is run by a go statement in its parent.
+func isStartedAsGoroutine(parent, anon *ssa.Function) bool {
+	for _, b := range parent.Blocks {
+		for _, instr := range b.Instrs {
+			g, ok := instr.(*ssa.Go)
+			if !ok {
+				continue
+			}
+			if fn, ok := g.Call.Value.(*ssa.Function); ok && fn == anon {
+				return true
+			}
+			if mc, ok := g.Call.Value.(*ssa.MakeClosure); ok && mc.Fn == anon {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,183 @@
+package protectedby
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// checkCopies reports copies of struct values that contain protected fields: assignments, range loops, function
+// arguments, returned values other than constructed ones and method calls with value receivers. The copied fields are
+// not synchronized with the original ones even if the lock is a pointer shared by both copies.
+func checkCopies(r *runState, m map[string]*protectedData) []*analysisError {
+	pass := r.pass
+	protected := make(map[*types.Var]*protectedData, len(m))
+	for _, p := range m {
+		if p.obj != nil {
+			protected[p.obj] = p
+		}
+	}
+	if len(protected) == 0 {
+		return nil
+	}
+
+	var errors []*analysisError
+	report := func(expr ast.Expr, typ types.Type) {
+		var fields []copiedField
+		copiedFields(typ, protected, "", &fields)
+		if len(fields) == 0 {
+			return
+		}
+
+		var names []string
+		var related []analysis.RelatedInformation
+		seen := make(map[token.Pos]bool)
+		for _, f := range fields {
+			names = append(names, f.name)
+			for _, info := range f.data.evidence() {
+				// Fields protected by the same lock share its declaration.
+				if !seen[info.Pos] {
+					seen[info.Pos] = true
+					related = append(related, info)
+				}
+			}
+		}
+		errors = append(errors, &analysisError{
+			msg: fmt.Sprintf("copy of %s by value, protected fields %s become unsynchronized copies",
+				types.TypeString(typ, types.RelativeTo(pass.Pkg)), strings.Join(names, ", ")),
+			pos:      expr.Pos(),
+			category: categoryProtectedCopy,
+			related:  related,
+		})
+	}
+	check := func(expr ast.Expr) {
+		if isCopy(pass, expr) {
+			report(expr, pass.TypesInfo.TypeOf(expr))
+		}
+	}
+
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fn, _ := decl.(*ast.FuncDecl)
+			ast.Inspect(decl, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.AssignStmt:
+					if len(n.Lhs) != len(n.Rhs) {
+						return true
+					}
+					for i, rhs := range n.Rhs {
+						if !isBlank(n.Lhs[i]) {
+							check(rhs)
+						}
+					}
+				case *ast.ValueSpec:
+					if len(n.Names) != len(n.Values) {
+						return true
+					}
+					for i, v := range n.Values {
+						if !isBlank(n.Names[i]) {
+							check(v)
+						}
+					}
+				case *ast.RangeStmt:
+					if n.Value != nil && !isBlank(n.Value) {
+						report(n.Value, pass.TypesInfo.TypeOf(n.Value))
+					}
+				case *ast.ReturnStmt:
+					for _, res := range n.Results {
+						// Returning a value constructed in the function moves it to the caller, e.g. in constructors.
+						if id, ok := ast.Unparen(res).(*ast.Ident); ok && fn != nil && r.isAllocatedIn(id, fn) {
+							continue
+						}
+						check(res)
+					}
+				case *ast.CallExpr:
+					args := n.Args
+					if tv := pass.TypesInfo.Types[n.Fun]; tv.IsType() {
+						return true
+					} else if tv.IsBuiltin() {
+						id, ok := ast.Unparen(n.Fun).(*ast.Ident)
+						if !ok || id.Name != "append" || len(args) == 0 {
+							return true
+						}
+						args = args[1:]
+					}
+					for _, arg := range args {
+						check(arg)
+					}
+				case *ast.SelectorExpr:
+					sel, ok := pass.TypesInfo.Selections[n]
+					if !ok || sel.Kind() != types.MethodVal {
+						return true
+					}
+					recv := sel.Obj().(*types.Func).Signature().Recv()
+					if recv == nil || types.IsInterface(recv.Type()) {
+						return true
+					}
+					if _, isPtr := recv.Type().Underlying().(*types.Pointer); !isPtr {
+						report(n.X, deref(sel.Recv()))
+					}
+				}
+
+				return true
+			})
+		}
+	}
+
+	return errors
+}
+
+// copiedField is a protected field contained in a copied value.
+type copiedField struct {
+	// name is the path to the field from the value, e.g. "stats.hits".
+	name string
+	data *protectedData
+}
+
+// copiedFields appends protected fields contained in a value of the type, including fields of nested struct and array
+// values.
+func copiedFields(typ types.Type, protected map[*types.Var]*protectedData, prefix string, res *[]copiedField) {
+	if typ == nil {
+		return
+	}
+
+	switch t := typ.Underlying().(type) {
+	case *types.Array:
+		copiedFields(t.Elem(), protected, prefix, res)
+	case *types.Struct:
+		for i := range t.NumFields() {
+			f := t.Field(i)
+			if p := protected[f.Origin()]; p != nil {
+				*res = append(*res, copiedField{name: prefix + f.Name(), data: p})
+				continue
+			}
+			copiedFields(f.Type(), protected, prefix+f.Name()+".", res)
+		}
+	}
+}
+
+// isCopy reports whether the expression copies an existing value. Composite literals and call results are new
+// values.
+func isCopy(pass *analysis.Pass, expr ast.Expr) bool {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.CompositeLit, *ast.FuncLit, *ast.BasicLit:
+		return false
+	case *ast.CallExpr:
+		// A conversion copies its operand.
+		if tv := pass.TypesInfo.Types[e.Fun]; tv.IsType() && len(e.Args) == 1 {
+			return isCopy(pass, e.Args[0])
+		}
+		return false
+	}
+
+	return true
+}
+
+func isBlank(expr ast.Expr) bool {
+	id, ok := ast.Unparen(expr).(*ast.Ident)
+	return ok && id.Name == "_"
+}
@@ -0,0 +1,116 @@
+package protectedby
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+var update = flag.Bool("update", false, "update the golden file of the corpus test")
+
+// TestCorpus runs the analyzer over the packages in testdata/corpus and compares the diagnostics with the golden file.
+// Run with -update to accept the new diagnostics.
+func TestCorpus(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "corpus"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join(dir, "diagnostics.golden")
+
+	entries, err := os.ReadDir(filepath.Join(dir, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patterns []string
+	for _, e := range entries {
+		if e.IsDir() {
+			patterns = append(patterns, e.Name()+"/...")
+		}
+	}
+
+	pkgs := loadPackages(t, dir, patterns...)
+	got := formatDiagnostics(t, filepath.Join(dir, "src"), pkgs, runAnalyzer(t, pkgs))
+
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("diagnostics differ from %s, run with -update to accept them:\n%s", golden, lineDiff(string(want), got))
+	}
+}
+
+// formatDiagnostics prints diagnostics with positions relative to the source root, sorted by position.
+// The category follows the message in brackets, related information is printed on the following lines with an indent.
+func formatDiagnostics(tb testing.TB, root string, pkgs []*packages.Package, diags []analysis.Diagnostic) string {
+	tb.Helper()
+
+	fset := pkgs[0].Fset
+	pos := func(p token.Pos) string {
+		position := fset.Position(p)
+		name, err := filepath.Rel(root, position.Filename)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return fmt.Sprintf("%s:%d:%d", filepath.ToSlash(name), position.Line, position.Column)
+	}
+
+	slices.SortStableFunc(diags, func(a, b analysis.Diagnostic) int {
+		pa, pb := fset.Position(a.Pos), fset.Position(b.Pos)
+		return cmp.Or(
+			cmp.Compare(pa.Filename, pb.Filename),
+			cmp.Compare(pa.Offset, pb.Offset),
+			cmp.Compare(a.Message, b.Message),
+		)
+	})
+
+	var b strings.Builder
+	for _, d := range diags {
+		fmt.Fprintf(&b, "%s: %s", pos(d.Pos), d.Message)
+		if d.Category != "" {
+			fmt.Fprintf(&b, " [%s]", d.Category)
+		}
+		b.WriteString("\n")
+		for _, r := range d.Related {
+			fmt.Fprintf(&b, "\t%s: %s\n", pos(r.Pos), r.Message)
+		}
+	}
+
+	return b.String()
+}
+
+// lineDiff returns the lines missing in got prefixed with "-" and the unexpected ones prefixed with "+".
+func lineDiff(want, got string) string {
+	wantLines := strings.Split(strings.TrimSuffix(want, "\n"), "\n")
+	gotLines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+
+	var b strings.Builder
+	for _, l := range wantLines {
+		if !slices.Contains(gotLines, l) {
+			fmt.Fprintf(&b, "-%s\n", l)
+		}
+	}
+	for _, l := range gotLines {
+		if !slices.Contains(wantLines, l) {
+			fmt.Fprintf(&b, "+%s\n", l)
+		}
+	}
+
+	return b.String()
+}
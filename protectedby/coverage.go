@@ -0,0 +1,136 @@
+package protectedby
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Coverage describes how much of the state of a package that lives next to locks is annotated. It is the result of
+// the analyzer.
+type Coverage struct {
+	// Structs are the structs with a sync.Locker field in source order.
+	Structs []*StructCoverage
+	// Suppressed are the annotated fields excluded from the checks by Config.Suppress, e.g. "Cache.items".
+	Suppressed []string
+}
+
+// StructCoverage describes the fields of a struct with a sync.Locker field.
+type StructCoverage struct {
+	// Name is the struct name as used in diagnostics, e.g. "Cache", or "server.stats" for an anonymous struct type of
+	// a field.
+	Name string
+	Pos  token.Pos
+	// Locks are the sync.Locker fields of the struct, e.g. "mu" or "sync.Mutex" for an embedded mutex.
+	Locks []string
+	// Fields are the other fields of the struct.
+	Fields []*FieldCoverage
+}
+
+// FieldCoverage describes a field declared next to a lock.
+type FieldCoverage struct {
+	Name string
+	// Annotation describes the annotation of the field, e.g. "protected by mu" or "accessed atomically". Empty if the
+	// field is not annotated.
+	Annotation string
+	// Suppressed is true if the field is annotated but excluded from the checks by Config.Suppress.
+	Suppressed bool
+	// Accesses is the number of checked accesses to the field in the package.
+	Accesses int
+}
+
+// Annotated returns the number of annotated fields of the struct, including suppressed ones.
+func (s *StructCoverage) Annotated() int {
+	n := 0
+	for _, f := range s.Fields {
+		if f.Annotation != "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// newCoverage returns the coverage of the package from the collected fields and their annotations. The number of
+// accesses is known once usages are added to the annotations, see addUsages.
+func newCoverage(pass *analysis.Pass, fields []*fieldNode, a *annotations) *Coverage {
+	res := &Coverage{}
+	structs := make(map[*ast.StructType]*StructCoverage)
+	for _, n := range fields {
+		st, ok := n.path[0].(*ast.StructType)
+		if !ok || !implementsLocker(pass, n.field) {
+			continue
+		}
+		s, ok := structs[st]
+		if !ok {
+			info := getEnclosingStruct(n.path)
+			if info == nil {
+				continue
+			}
+			s = &StructCoverage{Name: info.name, Pos: st.Pos()}
+			structs[st] = s
+			res.Structs = append(res.Structs, s)
+		}
+		if len(n.field.Names) == 0 {
+			s.Locks = append(s.Locks, types.ExprString(n.field.Type))
+		}
+		for _, name := range n.field.Names {
+			s.Locks = append(s.Locks, name.Name)
+		}
+	}
+
+	for _, n := range fields {
+		st, _ := n.path[0].(*ast.StructType)
+		s, ok := structs[st]
+		if !ok || implementsLocker(pass, n.field) {
+			continue
+		}
+		for _, name := range n.field.Names {
+			if name.Name == "_" {
+				continue
+			}
+			pName := protectedName(s.Name, name.Name)
+			annotation, usages := a.annotation(pName)
+			if obj, ok := pass.TypesInfo.Defs[name].(*types.Var); ok && a.conds[obj] != nil {
+				annotation = associatedWith + a.conds[obj].Name()
+			}
+			f := &FieldCoverage{Name: name.Name, Annotation: annotation, Accesses: len(usages)}
+			if suppressed, ok := a.suppressed[pName]; ok {
+				f.Annotation, f.Suppressed = suppressed, true
+			}
+			s.Fields = append(s.Fields, f)
+		}
+	}
+
+	for name := range a.suppressed {
+		res.Suppressed = append(res.Suppressed, name)
+	}
+	slices.Sort(res.Suppressed)
+
+	return res
+}
+
+// annotation returns the description of the annotation of the field with the given name, e.g. "protected by mu", and
+// the usages of the field. The description is empty if the field is not annotated.
+func (a *annotations) annotation(pName string) (string, []*usage) {
+	if p, ok := a.protected[pName]; ok {
+		return defaultProtectedBy + " " + getFieldName(p.lock), p.usages
+	}
+	if d, ok := a.atomic[pName]; ok {
+		return accessedAtomically, d.usages
+	}
+	if d, ok := a.immutable[pName]; ok {
+		if d.constructor != "" {
+			return immutable + " after " + d.constructor, d.usages
+		}
+		return immutable, d.usages
+	}
+	if d, ok := a.confined[pName]; ok {
+		return confinedTo + d.owner, d.usages
+	}
+
+	return "", nil
+}
@@ -0,0 +1,197 @@
+package protectedby
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// escapeError returns an error if a reference to the protected field, i.e. its address or a copy of a slice or map
+// header, escapes the critical section: it is returned, stored outside the function, captured by a closure, passed
+// to a function or used after the lock is released. A reference passed to a function declared in the package only
+// escapes if the function lets its parameter escape, other functions are assumed to retain it.
+func escapeError(r *runState, p *protectedData, u *usage, l lockRef) *analysisError {
+	refs := fieldReferences(r, u)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	fieldVar, _ := r.pass.TypesInfo.ObjectOf(u.selector.Sel).(*types.Var)
+	fn := refs[0].Parent()
+	seen := make(map[ssa.Value]bool)
+	for len(refs) > 0 {
+		v := refs[0]
+		refs = refs[1:]
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+
+		derived, escapes := followReference(v, fieldVar)
+		refs = append(refs, derived...)
+		// Releases are only known in the function of the usage, not in the callees the reference is passed to.
+		var unlock *lockOp
+		if v.Parent() == fn {
+			unlock = findUseAfterUnlock(u, v, l)
+		}
+		if escapes || unlock != nil {
+			related := p.evidence()
+			if unlock != nil {
+				related = append(related, releaseInfo(unlock))
+			}
+			return &analysisError{
+				msg:      fmt.Sprintf("reference to protected field %s escapes the critical section", getFieldName(p.field)),
+				pos:      u.selectorXID.Pos(),
+				category: categoryEscapingReference,
+				related:  related,
+			}
+		}
+	}
+
+	return nil
+}
+
+// fieldReferences returns SSA values that reference the protected field accessed in the usage: the address of the
+// field if it is taken explicitly, e.g. &s.f, or the copy of the field if it is a slice or a map.
+func fieldReferences(r *runState, u *usage) []ssa.Value {
+	parent, _ := parentExpr(u.path, 0)
+	unary, ok := parent.(*ast.UnaryExpr)
+	addressTaken := ok && unary.Op == token.AND
+
+	switch r.pass.TypesInfo.TypeOf(u.selector).Underlying().(type) {
+	case *types.Slice, *types.Map:
+	default:
+		if !addressTaken {
+			return nil
+		}
+	}
+
+	ssaInfo := r.buildSSA()
+	if ssaInfo == nil {
+		return nil
+	}
+
+	var res []ssa.Value
+	for _, instr := range ssaInfo.instrs[u.selector.Sel.Pos()] {
+		switch v := instr.(type) {
+		case *ssa.FieldAddr:
+			if addressTaken {
+				res = append(res, v)
+				continue
+			}
+			// The field is read from memory, the loaded value is the copy of the header.
+			for _, r := range *v.Referrers() {
+				if load, ok := r.(*ssa.UnOp); ok && load.Op == token.MUL {
+					res = append(res, load)
+				}
+			}
+		case *ssa.Field:
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// followReference returns values derived from the reference v that also reference the protected field, and reports
+// whether the reference escapes the function. Parameters of the callees declared in the package the reference is
+// passed to are derived values too.
+func followReference(v ssa.Value, fieldVar *types.Var) ([]ssa.Value, bool) {
+	var derived []ssa.Value
+	refs := v.Referrers()
+	if refs == nil {
+		return nil, false
+	}
+
+	for _, instr := range *refs {
+		switch instr := instr.(type) {
+		case *ssa.Store:
+			if instr.Addr == v {
+				// Write through the reference.
+				continue
+			}
+			switch addr := instr.Addr.(type) {
+			case *ssa.Alloc:
+				if addr.Heap {
+					return nil, true
+				}
+				// The reference is stored in a local variable, follow loads of the variable.
+				for _, r := range *addr.Referrers() {
+					if load, ok := r.(*ssa.UnOp); ok && load.Op == token.MUL {
+						derived = append(derived, load)
+					}
+				}
+			case *ssa.IndexAddr:
+				// The reference is packed into the arguments of a variadic call, follow the slice of the arguments.
+				args, ok := addr.X.(*ssa.Alloc)
+				if !ok || args.Comment != "varargs" {
+					return nil, true
+				}
+				for _, r := range *args.Referrers() {
+					if sl, ok := r.(*ssa.Slice); ok {
+						derived = append(derived, sl)
+					}
+				}
+			case *ssa.FieldAddr:
+				// Storing the value back to the same field, e.g. s.items = append(s.items, i), is fine.
+				if !isFieldAddrOf(addr, fieldVar) {
+					return nil, true
+				}
+			default:
+				return nil, true
+			}
+		case *ssa.Return, *ssa.MakeClosure, *ssa.Send, *ssa.Go, *ssa.Defer:
+			return nil, true
+		case *ssa.Call:
+			if b, ok := instr.Call.Value.(*ssa.Builtin); ok {
+				if b.Name() == "append" {
+					derived = append(derived, instr)
+				}
+				continue
+			}
+			// Dynamic calls and functions of other packages, which have no body, can retain their arguments.
+			callee := instr.Call.StaticCallee()
+			if callee == nil || len(callee.Blocks) == 0 {
+				return nil, true
+			}
+			for i, arg := range instr.Call.Args {
+				if arg == v && i < len(callee.Params) {
+					derived = append(derived, callee.Params[i])
+				}
+			}
+		case *ssa.Phi, *ssa.ChangeType, *ssa.Convert, *ssa.Slice, *ssa.IndexAddr, *ssa.FieldAddr,
+			*ssa.MakeInterface, *ssa.ChangeInterface, *ssa.SliceToArrayPointer:
+			derived = append(derived, instr.(ssa.Value))
+		}
+	}
+
+	return derived, false
+}
+
+func isFieldAddrOf(addr *ssa.FieldAddr, fieldVar *types.Var) bool {
+	st, ok := deref(addr.X.Type()).Underlying().(*types.Struct)
+	return ok && fieldVar != nil && st.Field(addr.Field).Origin() == fieldVar.Origin()
+}
+
+// findUseAfterUnlock returns the release of the lock that protects the field if the reference is used after it.
+func findUseAfterUnlock(u *usage, v ssa.Value, l lockRef) *lockOp {
+	refs := v.Referrers()
+	if refs == nil {
+		return nil
+	}
+
+	for _, instr := range *refs {
+		pos := instr.Pos()
+		if pos == token.NoPos || pos <= u.selectorXID.Pos() {
+			continue
+		}
+		if op := findUnlock(u, u.selectorXID.Pos(), pos, l); op != nil {
+			return op
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package protectedby
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+const immutableAfter = immutable + " after "
+
+// immutableData is a field annotated with "immutable" or "read-only after init". Such a field can be read without
+// locks, but it can only be written by the constructor.
+type immutableData struct {
+	*fieldData
+	// constructor is the name of the function that is allowed to write the field, e.g. "newServer" for the
+	// "immutable after newServer" annotation. Empty if the annotation does not name a constructor.
+	constructor string
+}
+
+func getImmutableData(pass *analysis.Pass, st *structInfo, field *ast.Field, c *ast.Comment) *immutableData {
+	d := &immutableData{
+		fieldData: newFieldData(pass, st, field, c),
+	}
+
+	text := annotationText(c)
+	if idx := phraseIndex(strings.ToLower(text), immutableAfter); idx != -1 {
+		if fields := strings.FieldsFunc(text[idx+len(immutableAfter):], isLetterOrNumber); len(fields) > 0 {
+			d.constructor = fields[0]
+		}
+	}
+
+	return d
+}
+
+// checkImmutableWrites reports writes to immutable fields. A write is allowed in the constructor named by the
+// annotation and in the function that allocated the struct value.
+func checkImmutableWrites(r *runState, m map[string]*immutableData) []*analysisError {
+	pass := r.pass
+	var errors []*analysisError
+	for _, d := range m {
+		for _, u := range d.usages {
+			if !isWrite(pass, u, false) {
+				continue
+			}
+			if d.constructor != "" && u.enclosingFunc.Name.Name == d.constructor {
+				continue
+			}
+			if r.isAllocatedIn(u.selectorXID, u.enclosingFunc) {
+				continue
+			}
+
+			msg := fmt.Sprintf("write to immutable field %s outside of constructor", getFieldName(d.field))
+			if d.constructor != "" {
+				msg += " " + d.constructor
+			}
+			errors = append(errors, &analysisError{
+				msg:      msg,
+				pos:      u.selectorXID.Pos(),
+				category: categoryImmutableWrite,
+				related:  d.evidence(),
+			})
+		}
+	}
+
+	return errors
+}
+
+// isWrite reports whether the usage modifies the field: the field or its part is assigned, incremented, ranged into
+// or its address is taken. If throughRefs is true, modifications of the values the field refers to count as well, e.g.
+// s.items[0] = 1, s.ptr.n++ or delete(s.index, k), which a read lock does not protect.
+func isWrite(pass *analysis.Pass, u *usage, throughRefs bool) bool {
+	var curr ast.Node = u.selector
+	parent, idx := parentExpr(u.path, 0)
+	for {
+		switch p := parent.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range p.Lhs {
+				if ast.Unparen(lhs) == curr {
+					return true
+				}
+			}
+			return false
+		case *ast.IncDecStmt:
+			return true
+		case *ast.RangeStmt:
+			return p.Key != nil && ast.Unparen(p.Key) == curr || p.Value != nil && ast.Unparen(p.Value) == curr
+		case *ast.UnaryExpr:
+			return p.Op == token.AND
+		case *ast.CallExpr:
+			id, ok := ast.Unparen(p.Fun).(*ast.Ident)
+			if !throughRefs || !ok || len(p.Args) == 0 || ast.Unparen(p.Args[0]) != curr {
+				return false
+			}
+			_, builtin := pass.TypesInfo.Uses[id].(*types.Builtin)
+			return builtin && (id.Name == "delete" || id.Name == "clear")
+		case *ast.StarExpr:
+			if !throughRefs {
+				return false
+			}
+		case *ast.SelectorExpr:
+			// Writing to a field of a struct value writes to the struct itself.
+			sel, ok := pass.TypesInfo.Selections[p]
+			if !ok || sel.Kind() != types.FieldVal || !throughRefs && isPointer(pass, curr) {
+				return false
+			}
+		case *ast.IndexExpr:
+			// Writing to an element of an array writes to the array itself.
+			if ast.Unparen(p.X) != curr {
+				return false
+			}
+			if _, ok := pass.TypesInfo.TypeOf(p.X).Underlying().(*types.Array); !ok && !throughRefs {
+				return false
+			}
+		default:
+			return false
+		}
+
+		curr = parent
+		parent, idx = parentExpr(u.path, idx)
+	}
+}
+
+func isPointer(pass *analysis.Pass, n ast.Node) bool {
+	expr, ok := n.(ast.Expr)
+	if !ok {
+		return false
+	}
+	_, ok = pass.TypesInfo.TypeOf(expr).Underlying().(*types.Pointer)
+	return ok
+}
+
+// isAllocatedIn reports whether the variable is assigned a newly allocated value, e.g. &T{}, T{} or new(T), in the
+// function or declared there as a zero struct value. The allocated variables are found once per function.
+func (r *runState) isAllocatedIn(id *ast.Ident, fn *ast.FuncDecl) bool {
+	obj := r.pass.TypesInfo.ObjectOf(id)
+	if obj == nil {
+		return false
+	}
+
+	allocated, ok := r.allocated[fn]
+	if !ok {
+		allocated = allocatedVars(r.pass, fn)
+		r.allocated[fn] = allocated
+	}
+
+	return allocated[obj]
+}
+
+func allocatedVars(pass *analysis.Pass, fn *ast.FuncDecl) map[types.Object]bool {
+	res := make(map[types.Object]bool)
+	ast.Inspect(fn, func(n ast.Node) bool {
+		switch stmt := n.(type) {
+		case *ast.AssignStmt:
+			if len(stmt.Lhs) != len(stmt.Rhs) {
+				return true
+			}
+			for i, lhs := range stmt.Lhs {
+				lid, ok := ast.Unparen(lhs).(*ast.Ident)
+				if ok && isAllocation(pass, stmt.Rhs[i]) {
+					if obj := pass.TypesInfo.ObjectOf(lid); obj != nil {
+						res[obj] = true
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			for i, name := range stmt.Names {
+				obj := pass.TypesInfo.ObjectOf(name)
+				if obj == nil {
+					continue
+				}
+				if len(stmt.Values) == 0 {
+					if _, isPtr := obj.Type().Underlying().(*types.Pointer); !isPtr {
+						res[obj] = true
+					}
+				} else if len(stmt.Values) == len(stmt.Names) && isAllocation(pass, stmt.Values[i]) {
+					res[obj] = true
+				}
+			}
+		}
+
+		return true
+	})
+
+	return res
+}
+
+func isAllocation(pass *analysis.Pass, expr ast.Expr) bool {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.CompositeLit:
+		return true
+	case *ast.UnaryExpr:
+		_, ok := ast.Unparen(e.X).(*ast.CompositeLit)
+		return e.Op == token.AND && ok
+	case *ast.CallExpr:
+		id, ok := ast.Unparen(e.Fun).(*ast.Ident)
+		if !ok {
+			return false
+		}
+		b, ok := pass.TypesInfo.ObjectOf(id).(*types.Builtin)
+		return ok && b.Name() == "new"
+	}
+
+	return false
+}
@@ -0,0 +1,243 @@
+package protectedby
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// lockKey identifies a chain of field selections starting with a variable, e.g. s.mu, within a run, see exprKey.
+type lockKey int
+
+// noKey is the key of expressions that are not chains of field selections.
+const noKey lockKey = 0
+
+// keyPart is the selection of an object from the chain identified by the parent key, or the variable the chain
+// starts with if the parent is noKey. Keys are interned by their parts, see runState.key.
+type keyPart struct {
+	parent lockKey
+	obj    types.Object
+}
+
+// lockAliases is a set of lock expressions known to refer to the same lock within a function, e.g. a.mu and b.mu
+// after a.mu = b.mu if mu is a pointer or an interface. Expressions are identified by exprKey.
+type lockAliases struct {
+	parent map[lockKey]lockKey
+}
+
+func (a *lockAliases) find(k lockKey) lockKey {
+	for {
+		p, ok := a.parent[k]
+		if !ok || p == k {
+			return k
+		}
+		k = p
+	}
+}
+
+func (a *lockAliases) union(k1, k2 lockKey) {
+	if k1 == noKey || k2 == noKey {
+		return
+	}
+	r1, r2 := a.find(k1), a.find(k2)
+	if r1 != r2 {
+		a.parent[r1] = r2
+		if _, ok := a.parent[r2]; !ok {
+			a.parent[r2] = r2
+		}
+	}
+}
+
+// class returns the keys of the expressions that refer to the same lock as the key, including the key itself.
+func (a *lockAliases) class(k lockKey) []lockKey {
+	res := []lockKey{k}
+	if _, ok := a.parent[k]; !ok {
+		return res
+	}
+
+	root := a.find(k)
+	for other := range a.parent {
+		if other != k && a.find(other) == root {
+			res = append(res, other)
+		}
+	}
+
+	return res
+}
+
+// addAliasPair records that the expressions with the given keys refer to the same lock after the position.
+func (st *funcLockState) addAliasPair(pos token.Pos, k1, k2 lockKey) {
+	if k1 != noKey && k2 != noKey {
+		st.aliasPairs = append(st.aliasPairs, aliasPair{pos: pos, k1: k1, k2: k2})
+	}
+}
+
+// aliasesBefore returns lock aliases established by assignments of pointer or interface typed values, e.g.
+// a.mu = b.mu, mu := b.mu or a := &T{mu: b.mu}, in the function before the given position. The aliases are built once
+// per number of assignments they consist of and shared by all sites between two assignments.
+func (st *funcLockState) aliasesBefore(before token.Pos) *lockAliases {
+	n := sort.Search(len(st.aliasPairs), func(i int) bool {
+		return st.aliasPairs[i].pos >= before
+	})
+	if res, ok := st.aliases[n]; ok {
+		return res
+	}
+
+	res := &lockAliases{parent: make(map[lockKey]lockKey)}
+	for _, p := range st.aliasPairs[:n] {
+		res.union(p.k1, p.k2)
+	}
+	if st.aliases == nil {
+		st.aliases = make(map[int]*lockAliases)
+	}
+	st.aliases[n] = res
+
+	return res
+}
+
+// aliasCompositeLit adds aliases for reference fields initialized in a composite literal, e.g. a := &T{mu: b.mu}.
+func (r *runState) aliasCompositeLit(st *funcLockState, a assignment) {
+	rhs := ast.Unparen(a.rhs)
+	if u, ok := rhs.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		rhs = ast.Unparen(u.X)
+	}
+	lit, ok := rhs.(*ast.CompositeLit)
+	if !ok {
+		return
+	}
+
+	lhsKey := r.exprKey(a.lhs)
+	if lhsKey == noKey {
+		return
+	}
+	pass := r.pass
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok || !isReference(pass.TypesInfo.TypeOf(kv.Value)) {
+			continue
+		}
+		st.addAliasPair(a.pos, r.key(lhsKey, pass.TypesInfo.ObjectOf(key)), r.exprKey(kv.Value))
+	}
+}
+
+// isReference reports whether copies of a value of the type refer to the same lock.
+func isReference(typ types.Type) bool {
+	if typ == nil {
+		return false
+	}
+
+	switch typ.Underlying().(type) {
+	case *types.Pointer, *types.Interface, *types.Chan:
+		return true
+	}
+
+	return false
+}
+
+// exprKey returns a key that identifies a chain of field selections starting with a variable, e.g. s.mu, or noKey if
+// the expression is not such a chain.
+func (r *runState) exprKey(expr ast.Expr) lockKey {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.Ident:
+		return r.key(noKey, r.pass.TypesInfo.ObjectOf(e))
+	case *ast.SelectorExpr:
+		// The locker of a condition is the lock it is associated with, e.g. s.cond.L is s.mu.
+		if base, lock := r.condLock(e); lock != nil {
+			x := r.exprKey(base)
+			if x == noKey {
+				return noKey
+			}
+			return r.key(x, lock)
+		}
+
+		x := r.exprKey(e.X)
+		if x == noKey {
+			return noKey
+		}
+		return r.key(x, r.pass.TypesInfo.ObjectOf(e.Sel))
+	}
+
+	return noKey
+}
+
+// key returns the key of the selection of the object from the chain identified by the parent key. Fields of generic
+// struct instantiations are identified by their origin.
+func (r *runState) key(parent lockKey, obj types.Object) lockKey {
+	if obj == nil {
+		return noKey
+	}
+	if v, ok := obj.(*types.Var); ok {
+		obj = v.Origin()
+	}
+
+	part := keyPart{parent: parent, obj: obj}
+	k, ok := r.keys[part]
+	if !ok {
+		k = lockKey(len(r.keys) + 1)
+		r.keys[part] = k
+	}
+
+	return k
+}
+
+// usageLockRef returns the lock that protects the field of the usage: the expected lock expression, its aliases and,
+// if the function selects the lock field from other expressions, the SSA value the lock is selected from. The lock
+// and the protected field selected from the same SSA value must alias, e.g. s and t after t := s if s is a pointer.
+// Copies of struct values are distinct values, so the lock of a copy does not protect the original and vice versa.
+func (r *runState) usageLockRef(u *usage, p *protectedData) lockRef {
+	expected := r.expectedLockKey(u, p)
+	if expected == noKey {
+		return lockRef{}
+	}
+
+	res := lockRef{keys: u.locks.aliasesBefore(u.selectorXID.Pos()).class(expected)}
+	field, _ := r.pass.TypesInfo.Defs[p.lock.Names[0]].(*types.Var)
+	if field == nil || !u.locks.hasOtherKeys(field.Origin(), res.keys) {
+		return res
+	}
+
+	ssaInfo := r.buildSSA()
+	if ssaInfo == nil {
+		return res
+	}
+	if base := ssaInfo.selectionBase(u.selector, p.lockDepth); base != nil {
+		r.indexBases(u.locks)
+		res.field, res.base = field.Origin(), base
+	}
+
+	return res
+}
+
+// selectionBase returns the SSA value the field is selected from. If depth is greater than zero, the value is the
+// struct that encloses the field depth levels up.
+func (p *packageSSA) selectionBase(sel *ast.SelectorExpr, depth int) ssa.Value {
+	var v ssa.Value
+	for _, instr := range p.instrs[sel.Sel.Pos()] {
+		switch instr := instr.(type) {
+		case *ssa.FieldAddr:
+			v = instr.X
+		case *ssa.Field:
+			v = instr.X
+		}
+	}
+
+	for range depth {
+		switch x := v.(type) {
+		case *ssa.FieldAddr:
+			v = x.X
+		case *ssa.Field:
+			v = x.X
+		default:
+			return nil
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,488 @@
+package protectedby
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+const (
+	acquiredBefore = "acquired before "
+	acquiredAfter  = "acquired after "
+)
+
+// lockOrderData is a declared order of two locks of the same struct, e.g. "mu acquired before stateMu" or
+// "stateMu acquired after mu". Locks are identified by lockID.
+type lockOrderData struct {
+	before, after string
+	// obj is the lock field that is acquired first. The order is exported as its fact.
+	obj *types.Var
+	pos token.Pos
+}
+
+// lockOrder is exported as a fact for lock fields that are declared to be acquired before other locks, so that the
+// order is checked in packages that use the locks.
+type lockOrder struct {
+	Lock   string
+	Before []string
+}
+
+func (*lockOrder) AFact() {}
+
+func (f *lockOrder) String() string {
+	return "acquired before " + strings.Join(f.Before, ", ")
+}
+
+// acquiredLocks is exported as a fact for exported functions that acquire locks, either directly or via static calls,
+// so that lock order is checked in call chains across packages.
+type acquiredLocks struct {
+	Locks []string
+}
+
+func (*acquiredLocks) AFact() {}
+
+func (f *acquiredLocks) String() string {
+	return "acquires " + strings.Join(f.Locks, ", ")
+}
+
+func getLockOrder(
+	pass *analysis.Pass, st *structInfo, field *ast.Field, c *ast.Comment,
+) (*lockOrderData, *analysisError) {
+	text := annotationText(c)
+	lower := strings.ToLower(text)
+	keyword, isBefore := acquiredBefore, true
+	idx := phraseIndex(lower, acquiredBefore)
+	if idx == -1 {
+		keyword, isBefore = acquiredAfter, false
+		idx = phraseIndex(lower, acquiredAfter)
+	}
+
+	names := strings.FieldsFunc(text[idx+len(keyword):], isLetterOrNumber)
+	if len(names) == 0 {
+		return nil, &analysisError{
+			msg:      fmt.Sprintf("failed to parse lock name from comment %q", text),
+			pos:      c.Pos(),
+			category: categoryAnnotationParseError,
+		}
+	}
+
+	other := getStructFieldByName(names[0], st.types[0])
+	if other == nil {
+		return nil, &analysisError{
+			msg:      fmt.Sprintf("struct %q does not have lock field %q", st.name, names[0]),
+			pos:      c.Pos(),
+			category: categoryUnknownLock,
+		}
+	}
+	// The annotated field is a lock, see parseComments.
+	if !isLock(pass, other) {
+		return nil, &analysisError{
+			msg:      fmt.Sprintf("lock %s doesn't implement sync.Locker interface", names[0]),
+			pos:      other.Pos(),
+			category: categoryLockNotLocker,
+			related:  []analysis.RelatedInformation{annotationInfo(c, "%s referenced here", names[0])},
+		}
+	}
+
+	first, second := field, other
+	if !isBefore {
+		first, second = other, field
+	}
+	obj, _ := pass.TypesInfo.Defs[first.Names[0]].(*types.Var)
+
+	return &lockOrderData{
+		before: pass.Pkg.Path() + "." + protectedName(st.name, getFieldName(first)),
+		after:  pass.Pkg.Path() + "." + protectedName(st.name, getFieldName(second)),
+		obj:    obj,
+		pos:    c.Pos(),
+	}, nil
+}
+
+// lockID returns the package qualified name of the lock the expression refers to, e.g. "example.com/pkg.server.mu"
+// for s.mu, or an empty string if the lock is neither a field of a named struct nor a package-level variable.
+func lockID(pass *analysis.Pass, expr ast.Expr) string {
+	var obj types.Object
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.Ident:
+		obj = pass.TypesInfo.ObjectOf(e)
+	case *ast.SelectorExpr:
+		sel, ok := pass.TypesInfo.Selections[e]
+		if !ok {
+			// Qualified identifier, e.g. pkg.mu.
+			obj = pass.TypesInfo.ObjectOf(e.Sel)
+			break
+		}
+		if sel.Kind() != types.FieldVal {
+			return ""
+		}
+
+		// The lock can be promoted from an embedded struct, the struct that declares it is the last one in the chain.
+		owner := sel.Recv()
+		idx := sel.Index()
+		for _, i := range idx[:len(idx)-1] {
+			st, ok := deref(owner).Underlying().(*types.Struct)
+			if !ok {
+				return ""
+			}
+			owner = st.Field(i).Type()
+		}
+		named, ok := types.Unalias(deref(owner)).(*types.Named)
+		if !ok || named.Obj().Pkg() == nil {
+			return ""
+		}
+		tn := named.Origin().Obj()
+		return tn.Pkg().Path() + "." + protectedName(tn.Name(), sel.Obj().Name())
+	}
+
+	v, ok := obj.(*types.Var)
+	if !ok || v.Pkg() == nil || v.Parent() != v.Pkg().Scope() {
+		return ""
+	}
+
+	return v.Pkg().Path() + "." + v.Name()
+}
+
+// lockEdge means that the lock held is acquired before the lock acquired: either declared by an annotation or observed
+// in a function that acquires the lock while holding the other one.
+type lockEdge struct {
+	held, acquired string
+	declared       bool
+	// pos is the annotation of a declared edge or the acquisition of an observed edge. It is not valid for edges
+	// declared in other packages.
+	pos token.Pos
+	// heldPos is the acquisition of the held lock of an observed edge.
+	heldPos token.Pos
+	// via is the name of the called function if the lock is acquired in a call.
+	via string
+}
+
+// lockGraph is the package-wide lock acquisition graph keyed by lockID of the lock held.
+type lockGraph map[string][]*lockEdge
+
+func (g lockGraph) add(e *lockEdge) {
+	g[e.held] = append(g[e.held], e)
+}
+
+// path returns the shortest chain of allowed edges from one lock to another or nil if there is no such chain.
+func (g lockGraph) path(from, to string, allow func(*lockEdge) bool) []*lockEdge {
+	prev := make(map[string]*lockEdge)
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n == to {
+			var res []*lockEdge
+			for n != from {
+				res = append(res, prev[n])
+				n = prev[n].held
+			}
+			slices.Reverse(res)
+			return res
+		}
+
+		for _, e := range g[n] {
+			if !allow(e) || visited[e.acquired] {
+				continue
+			}
+			visited[e.acquired] = true
+			prev[e.acquired] = e
+			queue = append(queue, e.acquired)
+		}
+	}
+
+	return nil
+}
+
+// lockEvent is an acquisition of a lock in a function body: either a direct acquisition or a call of a function that
+// acquires locks.
+type lockEvent struct {
+	pos token.Pos
+	// lock is the acquired lock expression, e.g. s.mu, id is its lockID and key is its exprKey. All of them are empty
+	// for calls.
+	lock ast.Expr
+	id   string
+	key  lockKey
+	// callee is the statically called function.
+	callee *types.Func
+}
+
+// funcLocks are the lock events of a function declared in the package.
+type funcLocks struct {
+	file   *ast.File
+	decl   *ast.FuncDecl
+	obj    *types.Func
+	events []*lockEvent
+	// held are the first acquisitions of distinct lock expressions in the function, see heldLockEdges.
+	held []*lockEvent
+}
+
+// checkLockOrder builds the lock acquisition graph of the package from declared lock orders, including orders of
+// imported locks, and locks acquired while other locks are held. An acquisition that closes a cycle in the graph is
+// reported as a potential deadlock.
+func checkLockOrder(r *runState, orders []*lockOrderData) []*analysisError {
+	pass := r.pass
+	exportLockOrders(pass, orders)
+
+	g := make(lockGraph)
+	// Channels are locks only if they are declared as such, other channel sends are not acquisitions.
+	chanLocks := make(map[string]bool)
+	for _, o := range orders {
+		g.add(&lockEdge{held: o.before, acquired: o.after, declared: true, pos: o.pos})
+		chanLocks[o.before], chanLocks[o.after] = true, true
+	}
+	for _, f := range pass.AllObjectFacts() {
+		o, ok := f.Fact.(*lockOrder)
+		if !ok || f.Object.Pkg() == pass.Pkg {
+			continue
+		}
+		for _, after := range o.Before {
+			g.add(&lockEdge{held: o.Lock, acquired: after, declared: true})
+			chanLocks[o.Lock], chanLocks[after] = true, true
+		}
+	}
+
+	funcs := collectLockEvents(r, chanLocks)
+	acquired := acquiredByFuncs(pass, funcs)
+	for _, f := range funcs {
+		if locks := acquired[f.obj]; f.obj.Exported() && len(locks) > 0 {
+			pass.ExportObjectFact(f.obj, &acquiredLocks{Locks: locks})
+		}
+	}
+
+	var observed []*lockEdge
+	for _, f := range funcs {
+		edges := heldLockEdges(r, f, acquired)
+		for _, e := range edges {
+			g.add(e)
+		}
+		observed = append(observed, edges...)
+	}
+
+	isDeclared := func(e *lockEdge) bool {
+		return e.declared
+	}
+	var errors []*analysisError
+	for _, e := range observed {
+		// An acquisition in the declared order is never blamed for a cycle, the acquisitions in the opposite order are.
+		if g.path(e.held, e.acquired, isDeclared) != nil {
+			continue
+		}
+		if path := g.path(e.acquired, e.held, func(other *lockEdge) bool { return other != e }); path != nil {
+			errors = append(errors, lockOrderError(pass, e, path))
+		}
+	}
+
+	return errors
+}
+
+func exportLockOrders(pass *analysis.Pass, orders []*lockOrderData) {
+	facts := make(map[*types.Var]*lockOrder)
+	for _, o := range orders {
+		if o.obj == nil {
+			continue
+		}
+		f, ok := facts[o.obj]
+		if !ok {
+			f = &lockOrder{Lock: o.before}
+			facts[o.obj] = f
+		}
+		if !slices.Contains(f.Before, o.after) {
+			f.Before = append(f.Before, o.after)
+		}
+	}
+
+	for obj, f := range facts {
+		slices.Sort(f.Before)
+		pass.ExportObjectFact(obj, f)
+	}
+}
+
+// collectLockEvents returns lock events of the functions declared in the package. Function literals, go and defer
+// statements are skipped since they are not executed in place.
+func collectLockEvents(r *runState, chanLocks map[string]bool) []*funcLocks {
+	pass := r.pass
+	var res []*funcLocks
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			obj, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+
+			f := &funcLocks{file: file, decl: fd, obj: obj}
+			seen := make(map[lockKey]bool)
+			ast.Inspect(fd.Body, func(n ast.Node) bool {
+				switch n.(type) {
+				case *ast.FuncLit, *ast.GoStmt, *ast.DeferStmt:
+					return false
+				}
+
+				if lock := acquiredLock(n); lock != nil {
+					id := lockID(pass, lock)
+					_, isSend := n.(*ast.SendStmt)
+					if id != "" && (isSend && chanLocks[id] || !isSend && isLockType(pass.TypesInfo.TypeOf(lock))) {
+						e := &lockEvent{pos: n.Pos(), lock: lock, id: id, key: r.exprKey(lock)}
+						f.events = append(f.events, e)
+						if e.key != noKey && !seen[e.key] {
+							seen[e.key] = true
+							f.held = append(f.held, e)
+						}
+					}
+					return true
+				}
+
+				if call, ok := n.(*ast.CallExpr); ok {
+					if callee := typeutil.StaticCallee(pass.TypesInfo, call); callee != nil {
+						f.events = append(f.events, &lockEvent{pos: call.Pos(), callee: callee.Origin()})
+					}
+				}
+
+				return true
+			})
+			res = append(res, f)
+		}
+	}
+
+	return res
+}
+
+// acquiredByFuncs returns sorted lockIDs of the locks acquired by the functions, including the locks acquired by
+// the functions they call.
+func acquiredByFuncs(pass *analysis.Pass, funcs []*funcLocks) map[*types.Func][]string {
+	res := make(map[*types.Func][]string)
+	for changed := true; changed; {
+		changed = false
+		for _, f := range funcs {
+			for _, e := range f.events {
+				for _, id := range eventLocks(pass, e, res) {
+					if !slices.Contains(res[f.obj], id) {
+						res[f.obj] = append(res[f.obj], id)
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for _, locks := range res {
+		slices.Sort(locks)
+	}
+
+	return res
+}
+
+// eventLocks returns lockIDs of the locks acquired by the event.
+func eventLocks(pass *analysis.Pass, e *lockEvent, acquired map[*types.Func][]string) []string {
+	if e.callee == nil {
+		return []string{e.id}
+	}
+	if e.callee.Pkg() == pass.Pkg {
+		return acquired[e.callee]
+	}
+
+	var f acquiredLocks
+	if pass.ImportObjectFact(e.callee, &f) {
+		return f.Locks
+	}
+
+	return nil
+}
+
+// heldLockEdges returns the edges observed in the function: a lock is acquired while another lock acquired earlier
+// in the function is not released yet.
+func heldLockEdges(r *runState, f *funcLocks, acquired map[*types.Func][]string) []*lockEdge {
+	var res []*lockEdge
+	for _, e := range f.events {
+		locks := eventLocks(r.pass, e, acquired)
+		if len(locks) == 0 {
+			continue
+		}
+		var via string
+		if e.callee != nil {
+			via = e.callee.Name()
+		}
+
+		for _, h := range f.held {
+			if h.pos >= e.pos {
+				break
+			}
+
+			s := site{file: f.file, fn: f.decl, pos: e.pos, locks: r.lockState(f.decl)}
+			ref := keyRef(h.key)
+			if !isLockHeld(s, ref, false) {
+				continue
+			}
+			heldPos := h.pos
+			if op := findAcquiredLock(s, ref); op != nil {
+				heldPos = op.lock.Pos()
+			}
+
+			for _, id := range locks {
+				if id == h.id {
+					continue
+				}
+				res = append(res, &lockEdge{held: h.id, acquired: id, pos: e.pos, heldPos: heldPos, via: via})
+			}
+		}
+	}
+
+	return res
+}
+
+// lockOrderError reports the observed edge that closes a cycle with the given path. If the rest of the cycle is
+// declared, the acquisition violates the declared order.
+func lockOrderError(pass *analysis.Pass, e *lockEdge, path []*lockEdge) *analysisError {
+	name := func(id string) string {
+		return strings.TrimPrefix(id, pass.Pkg.Path()+".")
+	}
+
+	acq := name(e.acquired) + " acquired"
+	if e.via != "" {
+		acq += " in call to " + e.via
+	}
+
+	declared := true
+	cycle := name(e.held) + " -> " + name(e.acquired)
+	order := name(path[0].held)
+	related := []analysis.RelatedInformation{{
+		Pos:     e.heldPos,
+		Message: fmt.Sprintf("%s acquired here", name(e.held)),
+	}}
+	for _, p := range path {
+		declared = declared && p.declared
+		cycle += " -> " + name(p.acquired)
+		order += " before " + name(p.acquired)
+		if !p.pos.IsValid() {
+			continue
+		}
+
+		msg := fmt.Sprintf("%s acquired while holding %s", name(p.acquired), name(p.held))
+		if p.declared {
+			msg = fmt.Sprintf("%s declared to be acquired before %s", name(p.held), name(p.acquired))
+		}
+		related = append(related, analysis.RelatedInformation{Pos: p.pos, Message: msg})
+	}
+
+	msg := fmt.Sprintf("potential deadlock: %s while holding %s, lock order cycle %s", acq, name(e.held), cycle)
+	if declared {
+		msg = fmt.Sprintf("lock %s while holding %s, declared order is %s", acq, name(e.held), order)
+	}
+
+	return &analysisError{
+		msg:      msg,
+		pos:      e.pos,
+		category: categoryLockOrder,
+		related:  related,
+	}
+}
@@ -0,0 +1,352 @@
+package protectedby
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+	"sort"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ssa"
+)
+
+// lockOp is a lock acquisition, a release or a TryLock condition in a function.
+type lockOp struct {
+	node ast.Node
+	lock ast.Expr
+	// deferStmt is the outermost deferred statement that encloses the operation, if any. nestedDefer is true if there
+	// are deferred statements nested in it that enclose the operation too.
+	deferStmt   *ast.DeferStmt
+	nestedDefer bool
+	// negated is true for TryLock conditions of the form !s.mu.TryLock().
+	negated bool
+	// read is true for RLock() and RUnlock() calls and TryRLock conditions, the lock only protects reads then.
+	read bool
+	// block is the innermost block statement or case clause that contains the operation.
+	block ast.Node
+	// key identifies the lock expression, see runState.indexLocks.
+	key lockKey
+	// field and base are the lock field and the SSA value it is selected from, see runState.indexBases. Both are nil
+	// if the lock is not a field selection or the bases are not indexed.
+	field *types.Var
+	base  ssa.Value
+}
+
+// visibleFrom reports whether the acquisition can be taken into account at a site: it is either not deferred or
+// deferred in the same statement as the site.
+func (op *lockOp) visibleFrom(s site) bool {
+	return op.deferStmt == nil || op.deferStmt == s.deferStmt && !op.nestedDefer
+}
+
+// assignment is a pair of assigned expressions in a function, see lockAliases.
+type assignment struct {
+	pos      token.Pos
+	lhs, rhs ast.Expr
+}
+
+// funcLockState holds lock operations and assignments of a function in source order. It is collected once per
+// function in the same traversal as annotated fields and their usages, and shared by all checks.
+type funcLockState struct {
+	acquired []*lockOp
+	released []*lockOp
+	// tryLocks are if and for statements whose condition is a TryLock() or TryRLock() call.
+	tryLocks []*lockOp
+	assigns  []assignment
+
+	// The operations indexed by runState.indexLocks.
+	acquiredIdx, releasedIdx, tryLocksIdx opIndex
+	// fieldKeys are the distinct keys of the operations on each lock field, including noKey.
+	fieldKeys map[*types.Var][]lockKey
+	// aliasPairs are the keys of the expressions assigned to each other in source order, see lockAliases.
+	aliasPairs []aliasPair
+	// aliases are lock aliases by the number of aliasPairs they are built of, see aliasesBefore.
+	aliases map[int]*lockAliases
+	// basesIndexed is true once runState.indexBases is done.
+	basesIndexed bool
+}
+
+// aliasPair is a pair of keys of expressions that refer to the same lock after the position.
+type aliasPair struct {
+	pos    token.Pos
+	k1, k2 lockKey
+}
+
+// opIndex holds lock operations of a function by the key of the lock and, once runState.indexBases is done, by the
+// lock field and the SSA value it is selected from. The lists are in source order.
+type opIndex struct {
+	byKey  map[lockKey][]*lockOp
+	byBase map[fieldBase][]*lockOp
+}
+
+// fieldBase is a lock field selected from an SSA value.
+type fieldBase struct {
+	field *types.Var
+	base  ssa.Value
+}
+
+// lists returns the lists of operations that can refer to the lock.
+func (x *opIndex) lists(l lockRef) [][]*lockOp {
+	var res [][]*lockOp
+	for _, k := range l.keys {
+		if ops := x.byKey[k]; len(ops) > 0 {
+			res = append(res, ops)
+		}
+	}
+	if l.base != nil {
+		if ops := x.byBase[fieldBase{l.field, l.base}]; len(ops) > 0 {
+			res = append(res, ops)
+		}
+	}
+
+	return res
+}
+
+// ops returns the operations that refer to the lock in source order. The result must not be modified.
+func (x *opIndex) ops(l lockRef) []*lockOp {
+	lists := x.lists(l)
+	if len(lists) == 1 {
+		return lists[0]
+	}
+
+	var res []*lockOp
+	seen := make(map[*lockOp]bool)
+	for _, ops := range lists {
+		for _, op := range ops {
+			if !seen[op] {
+				seen[op] = true
+				res = append(res, op)
+			}
+		}
+	}
+	slices.SortFunc(res, func(a, b *lockOp) int {
+		return int(a.node.Pos() - b.node.Pos())
+	})
+
+	return res
+}
+
+// lastBefore returns the index of the last operation of the list before the position or -1.
+func lastBefore(ops []*lockOp, pos token.Pos) int {
+	return sort.Search(len(ops), func(i int) bool {
+		return ops[i].node.Pos() >= pos
+	}) - 1
+}
+
+// lockRef identifies the lock expected to be held at a site: by the keys of the expressions that refer to it, i.e.
+// the key of the lock expression and the keys of its aliases, and by the SSA value the lock field is selected from,
+// see runState.usageLockRef.
+type lockRef struct {
+	keys []lockKey
+	// field and base are nil if the lock is identified by the keys only.
+	field *types.Var
+	base  ssa.Value
+}
+
+// keyRef returns the reference to the lock identified by the key alone.
+func keyRef(k lockKey) lockRef {
+	if k == noKey {
+		return lockRef{}
+	}
+
+	return lockRef{keys: []lockKey{k}}
+}
+
+func (l lockRef) matchesKey(k lockKey) bool {
+	return k != noKey && slices.Contains(l.keys, k)
+}
+
+func (l lockRef) matches(op *lockOp) bool {
+	return l.matchesKey(op.key) || l.base != nil && op.base == l.base && op.field == l.field
+}
+
+// runState is the state of a single run of the analyzer on a package shared by the checks. It is passed to the checks
+// rather than kept in package variables, so that concurrent runs on the same package do not interfere.
+type runState struct {
+	pass *analysis.Pass
+	// locks are the lock states of the functions declared in the package, see collect.
+	locks map[*ast.FuncDecl]*funcLockState
+	// conds are the locks of sync.Cond fields, see condLock.
+	conds condLocks
+	// keys are the interned lock keys, see exprKey.
+	keys map[keyPart]lockKey
+	// allocated are the variables allocated in functions, see isAllocatedIn.
+	allocated map[*ast.FuncDecl]map[types.Object]bool
+	// ssa is built on demand by buildSSA, ssaBuilt is true once it is attempted.
+	ssa      *packageSSA
+	ssaBuilt bool
+}
+
+func newRunState(pass *analysis.Pass, locks map[*ast.FuncDecl]*funcLockState, conds condLocks) *runState {
+	r := &runState{
+		pass:      pass,
+		locks:     locks,
+		conds:     conds,
+		keys:      make(map[keyPart]lockKey),
+		allocated: make(map[*ast.FuncDecl]map[types.Object]bool),
+	}
+	for _, st := range locks {
+		r.indexLocks(st)
+	}
+
+	return r
+}
+
+// lockState returns the lock state of the function. Functions without lock operations have an empty state.
+func (r *runState) lockState(fn *ast.FuncDecl) *funcLockState {
+	if st, ok := r.locks[fn]; ok {
+		return st
+	}
+
+	return &funcLockState{}
+}
+
+// indexLocks computes the keys of the lock operations and assignments of the function once, so that the operations
+// on a lock can be found without comparing each of them.
+func (r *runState) indexLocks(st *funcLockState) {
+	st.fieldKeys = make(map[*types.Var][]lockKey)
+	index := func(x *opIndex, ops []*lockOp) {
+		x.byKey = make(map[lockKey][]*lockOp)
+		for _, op := range ops {
+			op.key = r.exprKey(op.lock)
+			if field := selectedField(r.pass, op.lock); field != nil && !slices.Contains(st.fieldKeys[field], op.key) {
+				st.fieldKeys[field] = append(st.fieldKeys[field], op.key)
+			}
+			if op.key != noKey {
+				x.byKey[op.key] = append(x.byKey[op.key], op)
+			}
+		}
+	}
+	index(&st.acquiredIdx, st.acquired)
+	index(&st.releasedIdx, st.released)
+	index(&st.tryLocksIdx, st.tryLocks)
+
+	for _, a := range st.assigns {
+		if isReference(r.pass.TypesInfo.TypeOf(a.lhs)) {
+			st.addAliasPair(a.pos, r.exprKey(a.lhs), r.exprKey(a.rhs))
+		}
+		r.aliasCompositeLit(st, a)
+	}
+}
+
+// indexBases adds the SSA values the locks of the function are selected from to its lock operations, see
+// runState.usageLockRef.
+func (r *runState) indexBases(st *funcLockState) {
+	if st.basesIndexed {
+		return
+	}
+	st.basesIndexed = true
+
+	ssaInfo := r.buildSSA()
+	if ssaInfo == nil {
+		return
+	}
+	index := func(x *opIndex, ops []*lockOp) {
+		x.byBase = make(map[fieldBase][]*lockOp)
+		for _, op := range ops {
+			sel, ok := op.lock.(*ast.SelectorExpr)
+			if !ok {
+				continue
+			}
+			field := selectedField(r.pass, sel)
+			base := ssaInfo.selectionBase(sel, 0)
+			if field == nil || base == nil {
+				continue
+			}
+			op.field, op.base = field, base
+			k := fieldBase{field, base}
+			x.byBase[k] = append(x.byBase[k], op)
+		}
+	}
+	index(&st.acquiredIdx, st.acquired)
+	index(&st.releasedIdx, st.released)
+	index(&st.tryLocksIdx, st.tryLocks)
+}
+
+// hasOtherKeys reports whether the function has operations on the lock field with keys other than the given ones.
+func (st *funcLockState) hasOtherKeys(field *types.Var, keys []lockKey) bool {
+	for _, k := range st.fieldKeys[field] {
+		if !slices.Contains(keys, k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectedField returns the field the expression selects, e.g. mu for s.mu, or nil.
+func selectedField(pass *analysis.Pass, expr ast.Expr) *types.Var {
+	sel, ok := ast.Unparen(expr).(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	v, ok := pass.TypesInfo.ObjectOf(sel.Sel).(*types.Var)
+	if !ok || !v.IsField() {
+		return nil
+	}
+
+	return v.Origin()
+}
+
+// addNode records the lock operations of the node. The stack is the path from the file to the node, outermost first,
+// including the node.
+func (st *funcLockState) addNode(n ast.Node, stack []ast.Node) {
+	op := func(lock ast.Expr) *lockOp {
+		res := &lockOp{node: n, lock: lock}
+		for _, p := range stack[:len(stack)-1] {
+			switch p := p.(type) {
+			case *ast.DeferStmt:
+				if res.deferStmt == nil {
+					res.deferStmt = p
+				} else {
+					res.nestedDefer = true
+				}
+			case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+				res.block = p
+			}
+		}
+		return res
+	}
+
+	if lock := acquiredLock(n); lock != nil {
+		st.acquired = append(st.acquired, op(lock))
+	} else if lock := readLockCall(n, "RLock"); lock != nil {
+		o := op(lock)
+		o.read = true
+		st.acquired = append(st.acquired, o)
+	}
+	if lock := releasedLock(n); lock != nil {
+		st.released = append(st.released, op(lock))
+	} else if lock := readLockCall(n, "RUnlock"); lock != nil {
+		o := op(lock)
+		o.read = true
+		st.released = append(st.released, o)
+	}
+
+	switch n := n.(type) {
+	case *ast.IfStmt:
+		if lock, negated, read := tryLockCall(n.Cond); lock != nil {
+			o := op(lock)
+			o.negated, o.read = negated, read
+			st.tryLocks = append(st.tryLocks, o)
+		}
+	case *ast.ForStmt:
+		if lock, negated, read := tryLockCall(n.Cond); lock != nil {
+			o := op(lock)
+			o.negated, o.read = negated, read
+			st.tryLocks = append(st.tryLocks, o)
+		}
+	case *ast.AssignStmt:
+		if len(n.Lhs) == len(n.Rhs) {
+			for i := range n.Lhs {
+				st.assigns = append(st.assigns, assignment{pos: n.Pos(), lhs: n.Lhs[i], rhs: n.Rhs[i]})
+			}
+		}
+	case *ast.ValueSpec:
+		if len(n.Names) == len(n.Values) {
+			for i := range n.Names {
+				st.assigns = append(st.assigns, assignment{pos: n.Pos(), lhs: n.Names[i], rhs: n.Values[i]})
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package protectedby
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// notHeldReason explains why the lock is not held at the site, based on the lock operations of the function:
+//
+//	s.mu.Lock(); s.mu.Unlock(); s.i++               lock s.mu released at line N before access
+//	s.mu.RLock(); s.i++                             lock s.mu held for reading only, use s.mu.Lock()
+//	if c { s.mu.Lock(); ... } else { s.i++ }        lock s.mu acquired only in a different branch
+//	s.i++; s.mu.Lock()                              lock s.mu acquired after access
+//	p1.mu.Lock(); p2.i++                            a different instance's lock was taken (p1.mu vs p2.mu)
+//
+// expected is the lock expected to be held, e.g. s.mu, and lockObj is its field. Returns an empty reason if the
+// function does not explain it.
+func notHeldReason(
+	pass *analysis.Pass, s site, l lockRef, heldOnEntry bool, expected string, lockObj types.Object,
+) (string, []analysis.RelatedInformation) {
+	ops := s.locks.acquiredIdx.ops(l)
+	var acquired, enclosing []*lockOp
+	for _, op := range ops {
+		if op.visibleFrom(s) && op.node.Pos() > s.fn.Body.Pos() && op.node.Pos() < s.pos {
+			acquired = append(acquired, op)
+			if encloses(s, op) {
+				enclosing = append(enclosing, op)
+			}
+		}
+	}
+
+	if len(enclosing) > 0 && !s.readOnly {
+		if op := enclosing[len(enclosing)-1]; op.read && !isReleased(s, op.node.Pos(), l) {
+			return fmt.Sprintf("lock %s held for reading only, use %s.Lock()", types.ExprString(op.lock), expected),
+				[]analysis.RelatedInformation{acquiredInfo(op)}
+		}
+	}
+	if len(enclosing) == 0 && len(acquired) > 0 {
+		op := acquired[len(acquired)-1]
+		return fmt.Sprintf("lock %s acquired only in a different branch", types.ExprString(op.lock)),
+			[]analysis.RelatedInformation{acquiredInfo(op)}
+	}
+	if len(enclosing) > 0 || heldOnEntry {
+		from := s.fn.Body.Pos()
+		if len(enclosing) > 0 {
+			from = enclosing[len(enclosing)-1].node.Pos()
+		}
+		if op := findEnclosingRelease(s, from, l); op != nil {
+			line := pass.Fset.Position(op.node.Pos()).Line
+			return fmt.Sprintf("lock %s released at line %d before access", types.ExprString(op.lock), line),
+				[]analysis.RelatedInformation{releaseInfo(op)}
+		}
+		return "", nil
+	}
+
+	for _, op := range ops {
+		if op.node.Pos() > s.pos {
+			return fmt.Sprintf("lock %s acquired after access", types.ExprString(op.lock)),
+				[]analysis.RelatedInformation{acquiredInfo(op)}
+		}
+	}
+
+	for _, op := range s.locks.acquired {
+		if !op.visibleFrom(s) || op.node.Pos() >= s.pos || !isLockField(pass, op.lock, lockObj) {
+			continue
+		}
+		taken := types.ExprString(op.lock)
+		if taken != expected && !isReleased(s, op.node.Pos(), keyRef(op.key)) {
+			return fmt.Sprintf("a different instance's lock was taken (%s vs %s)", taken, expected),
+				[]analysis.RelatedInformation{acquiredInfo(op)}
+		}
+	}
+
+	return "", nil
+}
+
+// findEnclosingRelease returns the release of a lock after the given position that leaves the site unprotected.
+// Releases in blocks that enclose the site are preferred to releases in other branches.
+func findEnclosingRelease(s site, from token.Pos, l lockRef) *lockOp {
+	var res *lockOp
+	for _, op := range s.locks.releasedIdx.ops(l) {
+		if pos := op.node.Pos(); pos > from && pos < s.pos && op.deferStmt == s.deferStmt && encloses(s, op) {
+			res = op
+		}
+	}
+	if res == nil {
+		res = findRelease(s, from, l)
+	}
+
+	return res
+}
+
+// encloses reports whether the block that contains the operation, e.g. a Lock() call, contains the site too.
+func encloses(s site, op *lockOp) bool {
+	return op.block != nil && within(s.pos, op.block)
+}
+
+// isLockField reports whether the expression selects the lock field, e.g. p1.mu for the field mu.
+func isLockField(pass *analysis.Pass, expr ast.Expr, lockObj types.Object) bool {
+	sel, ok := ast.Unparen(expr).(*ast.SelectorExpr)
+	if !ok || lockObj == nil {
+		return false
+	}
+	obj, ok := pass.TypesInfo.Uses[sel.Sel].(*types.Var)
+	return ok && obj.Origin() == lockObj
+}
+
+func acquiredInfo(op *lockOp) analysis.RelatedInformation {
+	return analysis.RelatedInformation{
+		Pos:     op.node.Pos(),
+		End:     op.node.End(),
+		Message: fmt.Sprintf("%s acquired here", types.ExprString(op.lock)),
+	}
+}
@@ -0,0 +1,433 @@
+package protectedby
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+const (
+	calledWith = "called with "
+	heldSuffix = " held"
+	// receiverParam is the lockPrecondition.Param of locks selected from the receiver.
+	receiverParam = -1
+)
+
+// lockPrecondition is a lock that must be held when a function is called. It is declared in the function or
+// interface method comment, e.g. "called with mu held" for the receiver lock or "called with d.mu held" for the lock
+// of the parameter d.
+type lockPrecondition struct {
+	// Param is the index of the parameter the lock is selected from or receiverParam.
+	Param int
+	// Path is the chain of field names from the parameter to the lock, e.g. ["mu"] for d.mu.
+	Path []string
+}
+
+// lockPreconditions is exported as a fact for functions and methods, including interface methods, so that
+// implementations and callers in other packages are checked too.
+type lockPreconditions struct {
+	Locks []lockPrecondition
+}
+
+func (*lockPreconditions) AFact() {}
+
+func (f *lockPreconditions) String() string {
+	var locks []string
+	for _, l := range f.Locks {
+		base := "recv"
+		if l.Param != receiverParam {
+			base = fmt.Sprintf("arg%d", l.Param)
+		}
+		locks = append(locks, base+"."+strings.Join(l.Path, "."))
+	}
+	return "called with " + strings.Join(locks, ", ") + " held"
+}
+
+// preconditions maps functions declared in the package to the locks that must be held when they are called.
+type preconditions map[*types.Func][]lockPrecondition
+
+// findPreconditions parses "called with <lock> held" annotations of functions, methods and interface methods of the
+// package. Methods implementing an annotated interface method, declared in the package or imported, inherit its
+// preconditions unless they are annotated themselves.
+func findPreconditions(pass *analysis.Pass) (preconditions, []*analysisError) {
+	res := make(preconditions)
+	var errors []*analysisError
+
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				fn, ok := pass.TypesInfo.Defs[n.Name].(*types.Func)
+				if !ok {
+					return false
+				}
+				locks, errs := parsePreconditions(pass, fn, n.Recv, n.Type, n.Doc)
+				errors = append(errors, errs...)
+				if len(locks) > 0 {
+					res[fn] = locks
+				}
+				return false
+			case *ast.InterfaceType:
+				for _, m := range n.Methods.List {
+					ft, ok := m.Type.(*ast.FuncType)
+					if !ok || len(m.Names) != 1 {
+						continue
+					}
+					fn, ok := pass.TypesInfo.Defs[m.Names[0]].(*types.Func)
+					if !ok {
+						continue
+					}
+					var locks []lockPrecondition
+					for _, cg := range []*ast.CommentGroup{m.Doc, m.Comment} {
+						l, errs := parsePreconditions(pass, fn, nil, ft, cg)
+						locks = append(locks, l...)
+						errors = append(errors, errs...)
+					}
+					if len(locks) > 0 {
+						res[fn] = locks
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	inheritPreconditions(pass, res)
+
+	for fn, locks := range res {
+		pass.ExportObjectFact(fn, &lockPreconditions{Locks: locks})
+	}
+
+	return res, errors
+}
+
+// parsePreconditions returns locks declared in the comment group of the function. Interface methods do not have
+// a receiver field list, nevertheless their locks can be selected from the receiver, i.e. the implementing type.
+func parsePreconditions(
+	pass *analysis.Pass, fn *types.Func, recv *ast.FieldList, ft *ast.FuncType, cg *ast.CommentGroup,
+) ([]lockPrecondition, []*analysisError) {
+	if cg == nil {
+		return nil, nil
+	}
+
+	sig := fn.Signature()
+	isInterfaceMethod := sig.Recv() != nil && types.IsInterface(sig.Recv().Type())
+	var recvName string
+	if recv != nil && len(recv.List) == 1 && len(recv.List[0].Names) == 1 {
+		recvName = recv.List[0].Names[0].Name
+	}
+	var paramNames []string
+	for _, field := range ft.Params.List {
+		if len(field.Names) == 0 {
+			paramNames = append(paramNames, "")
+		}
+		for _, n := range field.Names {
+			paramNames = append(paramNames, n.Name)
+		}
+	}
+
+	var locks []lockPrecondition
+	var errors []*analysisError
+	for _, c := range cg.List {
+		text := annotationText(c)
+		idx := phraseIndex(strings.ToLower(text), calledWith)
+		if idx == -1 {
+			continue
+		}
+		// The comment is prose rather than an annotation unless a lock name is directly followed by "held", e.g.
+		// "Flush can be called with a nil writer" or "Reset is called with the lock held".
+		rest := text[idx+len(calledWith):]
+		end := strings.Index(strings.ToLower(rest), heldSuffix)
+		if end == -1 {
+			continue
+		}
+		lockName := strings.Trim(strings.TrimSpace(rest[:end]), "\"`'")
+		if !isLockPath(lockName) {
+			continue
+		}
+
+		parts := strings.Split(lockName, ".")
+		l := lockPrecondition{Param: receiverParam, Path: parts}
+		switch {
+		case len(parts) > 1 && recvName != "" && parts[0] == recvName:
+			l.Path = parts[1:]
+		case len(parts) > 1 && indexOf(paramNames, parts[0]) != -1:
+			l.Param = indexOf(paramNames, parts[0])
+			l.Path = parts[1:]
+		case sig.Recv() == nil:
+			errors = append(errors, &analysisError{
+				msg:      fmt.Sprintf("lock %s of function %s is not a field of its parameters", lockName, fn.Name()),
+				pos:      c.Pos(),
+				category: categoryUnknownLock,
+			})
+			continue
+		}
+
+		// Receiver locks of interface methods are resolved in the implementing types.
+		if !isInterfaceMethod || l.Param != receiverParam {
+			base := preconditionBase(sig, l)
+			if base == nil {
+				errors = append(errors, &analysisError{
+					msg:      fmt.Sprintf("function %s requires unknown lock %s", fn.Name(), lockName),
+					pos:      c.Pos(),
+					category: categoryUnknownLock,
+				})
+				continue
+			}
+			if _, typ := preconditionFields(pass, base.Type(), l.Path); typ == nil || !isLockType(typ) {
+				errors = append(errors, &analysisError{
+					msg:      fmt.Sprintf("function %s requires unknown lock %s", fn.Name(), lockName),
+					pos:      c.Pos(),
+					category: categoryUnknownLock,
+				})
+				continue
+			}
+		}
+
+		locks = append(locks, l)
+	}
+
+	return locks, errors
+}
+
+// isLockPath reports whether the name is an identifier or a chain of selected identifiers, e.g. mu or d.mu.
+func isLockPath(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if !token.IsIdentifier(part) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name && n != "_" {
+			return i
+		}
+	}
+	return -1
+}
+
+func isLockType(typ types.Type) bool {
+	if types.Implements(typ, syncLocker) || types.Implements(types.NewPointer(typ), syncLocker) {
+		return true
+	}
+	ch, ok := typ.Underlying().(*types.Chan)
+	return ok && ch.Dir() == types.SendRecv
+}
+
+// inheritPreconditions adds preconditions of annotated interface methods to the methods of the package types that
+// implement the interfaces.
+func inheritPreconditions(pass *analysis.Pass, res preconditions) {
+	ifaceMethods := make(map[*types.Func][]lockPrecondition)
+	for fn, locks := range res {
+		if recv := fn.Signature().Recv(); recv != nil && types.IsInterface(recv.Type()) {
+			ifaceMethods[fn] = locks
+		}
+	}
+	for _, f := range pass.AllObjectFacts() {
+		fn, ok := f.Object.(*types.Func)
+		if !ok || fn.Pkg() == pass.Pkg {
+			continue
+		}
+		if recv := fn.Signature().Recv(); recv != nil && types.IsInterface(recv.Type()) {
+			ifaceMethods[fn] = f.Fact.(*lockPreconditions).Locks
+		}
+	}
+	if len(ifaceMethods) == 0 {
+		return
+	}
+
+	scope := pass.Pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() || types.IsInterface(tn.Type()) {
+			continue
+		}
+		if named, ok := tn.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+			continue
+		}
+
+		for m, locks := range ifaceMethods {
+			iface, ok := m.Signature().Recv().Type().Underlying().(*types.Interface)
+			if !ok {
+				continue
+			}
+			if !types.Implements(tn.Type(), iface) && !types.Implements(types.NewPointer(tn.Type()), iface) {
+				continue
+			}
+
+			obj, _, _ := types.LookupFieldOrMethod(tn.Type(), true, pass.Pkg, m.Name())
+			impl, ok := obj.(*types.Func)
+			if !ok || impl.Pkg() != pass.Pkg || len(res[impl]) > 0 {
+				continue
+			}
+			res[impl] = locks
+		}
+	}
+}
+
+// lookup returns preconditions of the function declared either in the package or imported.
+func (p preconditions) lookup(pass *analysis.Pass, fn *types.Func) []lockPrecondition {
+	fn = fn.Origin()
+	if locks, ok := p[fn]; ok || fn.Pkg() == pass.Pkg {
+		return locks
+	}
+
+	var f lockPreconditions
+	if pass.ImportObjectFact(fn, &f) {
+		return f.Locks
+	}
+
+	return nil
+}
+
+// heldOnEntry reports whether the function is called with a lock held that satisfies match. Locks are identified by
+// exprKey.
+func (p preconditions) heldOnEntry(r *runState, decl *ast.FuncDecl, match func(key lockKey) bool) bool {
+	fn, ok := r.pass.TypesInfo.Defs[decl.Name].(*types.Func)
+	if !ok {
+		return false
+	}
+
+	for _, l := range p.lookup(r.pass, fn) {
+		base := preconditionBase(fn.Signature(), l)
+		if base == nil {
+			continue
+		}
+		fields, _ := preconditionFields(r.pass, base.Type(), l.Path)
+		if fields != nil && match(r.fieldsKey(r.key(noKey, base), fields)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// preconditionBase returns the receiver or the parameter the lock is selected from.
+func preconditionBase(sig *types.Signature, l lockPrecondition) *types.Var {
+	if l.Param == receiverParam {
+		return sig.Recv()
+	}
+	if l.Param < sig.Params().Len() {
+		return sig.Params().At(l.Param)
+	}
+
+	return nil
+}
+
+// preconditionFields resolves the path of field names starting from a value of the given type. It returns the fields
+// and the type of the last field, or nil if the path cannot be resolved.
+func preconditionFields(pass *analysis.Pass, typ types.Type, path []string) ([]*types.Var, types.Type) {
+	var fields []*types.Var
+	for _, name := range path {
+		obj, _, _ := types.LookupFieldOrMethod(typ, true, pass.Pkg, name)
+		v, ok := obj.(*types.Var)
+		if !ok || !v.IsField() {
+			return nil, nil
+		}
+		fields = append(fields, v)
+		typ = v.Type()
+	}
+
+	return fields, typ
+}
+
+// fieldsKey returns the key of the chain of field selections from the expression identified by the base key.
+func (r *runState) fieldsKey(base lockKey, fields []*types.Var) lockKey {
+	k := base
+	for _, f := range fields {
+		if k == noKey {
+			return noKey
+		}
+		k = r.key(k, f)
+	}
+
+	return k
+}
+
+// checkPreconditionCalls reports calls of functions with preconditions, including calls via interfaces, made without
+// holding the required locks.
+func checkPreconditionCalls(r *runState, calls []*callSite, preconds preconditions) []*analysisError {
+	pass := r.pass
+	var errors []*analysisError
+	for _, c := range calls {
+		callee, ok := typeutil.Callee(pass.TypesInfo, c.call).(*types.Func)
+		if !ok {
+			continue
+		}
+		locks := preconds.lookup(pass, callee)
+		if len(locks) == 0 {
+			continue
+		}
+		aliases := c.locks.aliasesBefore(c.pos)
+		recv := callee.Signature().Recv()
+		viaInterface := recv != nil && types.IsInterface(recv.Type())
+
+		for _, l := range locks {
+			// The receiver lock of an interface method is a field of the dynamic type, which is not known at the call.
+			if viaInterface && l.Param == receiverParam {
+				continue
+			}
+
+			base := preconditionArg(c.call, l)
+			if base == nil {
+				continue
+			}
+			baseKey := r.exprKey(base)
+			if baseKey == noKey {
+				continue
+			}
+
+			fields, _ := preconditionFields(pass, pass.TypesInfo.TypeOf(base), l.Path)
+			if fields == nil {
+				continue
+			}
+
+			ref := lockRef{keys: aliases.class(r.fieldsKey(baseKey, fields))}
+			if isLockHeld(c.site, ref, preconds.heldOnEntry(r, c.fn, ref.matchesKey)) {
+				continue
+			}
+
+			related := []analysis.RelatedInformation{{
+				Pos:     callee.Pos(),
+				Message: fmt.Sprintf("%s requires %s.%s held", callee.Name(), types.ExprString(base), strings.Join(l.Path, ".")),
+			}}
+			if op := findOffendingRelease(c.site, ref); op != nil {
+				related = append(related, releaseInfo(op))
+			}
+			errors = append(errors, &analysisError{
+				msg: fmt.Sprintf("not protected call to %s, use %s.%s.Lock()",
+					callee.Name(), types.ExprString(base), strings.Join(l.Path, ".")),
+				pos:      c.call.Pos(),
+				category: categoryUnprotectedCall,
+				related:  related,
+			})
+		}
+	}
+
+	return errors
+}
+
+// preconditionArg returns the call argument or the receiver expression the lock is selected from.
+func preconditionArg(call *ast.CallExpr, l lockPrecondition) ast.Expr {
+	if l.Param == receiverParam {
+		sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+		if !ok {
+			return nil
+		}
+		return sel.X
+	}
+	if l.Param < len(call.Args) {
+		return call.Args[l.Param]
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package protectedby
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// packageSSA is the SSA form of the analyzed package.
+type packageSSA struct {
+	pkg *ssa.Package
+	// srcFuncs are the functions declared in the package, including function literals, in source order.
+	srcFuncs []*ssa.Function
+	// funcs maps function declarations and literals to srcFuncs.
+	funcs map[ast.Node]*ssa.Function
+	// instrs are the instructions of srcFuncs by their position.
+	instrs map[token.Pos][]ssa.Instruction
+}
+
+// buildSSA returns the SSA form of the package. It is built on demand instead of requiring buildssa.Analyzer because
+// the analyzer runs on all dependencies to export facts while only some checks need SSA. Returns nil if the package
+// cannot be built, in which case SSA based checks are skipped.
+func (r *runState) buildSSA() (res *packageSSA) {
+	if r.ssaBuilt {
+		return r.ssa
+	}
+	defer func() {
+		if recover() != nil {
+			res = nil
+		}
+		r.ssa, r.ssaBuilt = res, true
+	}()
+
+	pass := r.pass
+	prog := ssa.NewProgram(pass.Fset, 0)
+	for _, p := range pass.Pkg.Imports() {
+		prog.CreatePackage(p, nil, nil, true)
+	}
+	pkg := prog.CreatePackage(pass.Pkg, pass.Files, pass.TypesInfo, false)
+	pkg.Build()
+
+	res = &packageSSA{
+		pkg:    pkg,
+		funcs:  make(map[ast.Node]*ssa.Function),
+		instrs: make(map[token.Pos][]ssa.Instruction),
+	}
+	var addAnons func(f *ssa.Function)
+	addAnons = func(f *ssa.Function) {
+		res.srcFuncs = append(res.srcFuncs, f)
+		if syntax := f.Syntax(); syntax != nil {
+			res.funcs[syntax] = f
+		}
+		for _, b := range f.Blocks {
+			for _, instr := range b.Instrs {
+				if pos := instr.Pos(); pos.IsValid() {
+					res.instrs[pos] = append(res.instrs[pos], instr)
+				}
+			}
+		}
+		for _, anon := range f.AnonFuncs {
+			addAnons(anon)
+		}
+	}
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			fn, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			if f := prog.FuncValue(fn); f != nil {
+				addAnons(f)
+			}
+		}
+	}
+
+	return res
+}
+
+// enclosingFunction returns the SSA function of the innermost function declaration or literal on the path, e.g.
+// usage.path, or nil if the function is not built.
+func (p *packageSSA) enclosingFunction(path []ast.Node) *ssa.Function {
+	for _, n := range path {
+		switch n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			return p.funcs[n]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+// Package cache is an LRU cache with expiring entries.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// Cache is a size bounded LRU cache.
+type Cache struct {
+	// items is protected by mu.
+	items map[string]*list.Element
+	// order is protected by mu.
+	order *list.List
+	// size is protected by mu.
+	size int
+	// limit is read-only after initialization.
+	limit int
+
+	mu sync.Mutex
+}
+
+// New returns a cache that holds at most limit bytes.
+func New(limit int) *Cache {
+	return &Cache{
+		items: make(map[string]*list.Element),
+		order: list.New(),
+		limit: limit,
+	}
+}
+
+// Get returns the value stored for the key.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	el, ok := c.items[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.mu.Lock()
+		c.remove(el)
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// Set stores the value for the key.
+func (c *Cache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	el := c.order.PushFront(&entry{key: key, value: value, expires: time.Now().Add(ttl)})
+	c.items[key] = el
+	c.size += len(value)
+	for c.size > c.limit {
+		c.remove(c.order.Back())
+	}
+}
+
+// Len returns the number of entries.
+func (c *Cache) Len() int {
+	return len(c.items)
+}
+
+// Size returns the total size of the values.
+func (c *Cache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
+
+// Resize changes the limit of the cache.
+func (c *Cache) Resize(limit int) {
+	c.mu.Lock()
+	c.limit = limit
+	c.mu.Unlock()
+}
+
+// remove must be called with mu held.
+func (c *Cache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.size -= len(e.value)
+}
+
+// Purge removes expired entries in the background until stop is closed.
+func (c *Cache) Purge(stop <-chan struct{}, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			c.mu.Lock()
+			for el := c.order.Back(); el != nil; {
+				prev := el.Prev()
+				if now.After(el.Value.(*entry).expires) {
+					c.remove(el)
+				}
+				el = prev
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Snapshot returns a copy of the cache.
+func (c *Cache) Snapshot() Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return *c
+}
@@ -0,0 +1,131 @@
+// Package jobs runs jobs on a pool of workers.
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+// Job is a unit of work.
+type Job func(ctx context.Context) error
+
+// Pool runs jobs concurrently.
+type Pool struct {
+	// queue is protected by mu.
+	queue []Job
+	// running is protected by mu.
+	running int
+	// errs is protected by errMu.
+	errs []error
+	// closed is protected by mu.
+	closed bool
+
+	// ready is associated with mu.
+	ready *sync.Cond
+	mu    sync.Mutex
+	// errMu is acquired after mu.
+	errMu sync.Mutex
+	wg    sync.WaitGroup
+}
+
+// NewPool starts n workers.
+func NewPool(ctx context.Context, n int) *Pool {
+	p := &Pool{}
+	p.ready = sync.NewCond(&p.mu)
+	for range n {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+
+	return p
+}
+
+// Submit adds the job to the queue.
+func (p *Pool) Submit(j Job) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	p.queue = append(p.queue, j)
+	p.ready.Signal()
+	return true
+}
+
+func (p *Pool) work(ctx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		j, ok := p.next()
+		if !ok {
+			return
+		}
+
+		if err := j(ctx); err != nil {
+			p.errMu.Lock()
+			p.errs = append(p.errs, err)
+			p.errMu.Unlock()
+		}
+
+		p.mu.Lock()
+		p.running--
+		p.mu.Unlock()
+	}
+}
+
+// next waits for a job and takes it from the queue. Returns false if the pool is closed and the queue is empty.
+func (p *Pool) next() (Job, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.queue) == 0 && !p.closed {
+		p.ready.Wait()
+	}
+	if len(p.queue) == 0 {
+		return nil, false
+	}
+	j := p.queue[0]
+	p.queue = p.queue[1:]
+	p.running++
+	return j, true
+}
+
+// Pending returns the number of queued jobs.
+func (p *Pool) Pending() int {
+	if p.closed {
+		return 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue)
+}
+
+// Errors returns the errors of failed jobs.
+func (p *Pool) Errors() []error {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make([]error, len(p.errs))
+	copy(res, p.errs)
+	return res
+}
+
+// Wake wakes up a worker.
+func (p *Pool) Wake() {
+	p.ready.Signal()
+	p.ready.Wait()
+}
+
+// Close stops the workers after the queued jobs are done.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.ready.Broadcast()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
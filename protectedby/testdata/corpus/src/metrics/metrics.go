@@ -0,0 +1,92 @@
+// Package metrics collects request metrics.
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type histogram struct {
+	// buckets is protected by mu.
+	buckets []uint64
+	// sum is protected by mu.
+	sum float64
+	mu  sync.Mutex
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := int(v)
+	if i >= len(h.buckets) {
+		i = len(h.buckets) - 1
+	}
+	h.buckets[i]++
+	h.sum += v
+}
+
+// Registry holds metrics by name.
+type Registry struct {
+	// requests is accessed atomically.
+	requests int64
+	// inflight is accessed atomically.
+	inflight atomic.Int64
+	// histograms is protected by mu.
+	histograms map[string]*histogram
+
+	mu sync.Mutex
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{histograms: make(map[string]*histogram)}
+}
+
+// Observe records the value in the named histogram.
+func (r *Registry) Observe(name string, v float64) {
+	atomic.AddInt64(&r.requests, 1)
+	r.inflight.Add(1)
+	defer r.inflight.Add(-1)
+
+	r.mu.Lock()
+	h, ok := r.histograms[name]
+	r.mu.Unlock()
+	if !ok {
+		r.mu.Lock()
+		h = &histogram{buckets: make([]uint64, 10)}
+		r.histograms[name] = h
+		r.mu.Unlock()
+	}
+	h.observe(v)
+}
+
+// Requests returns the number of observations.
+func (r *Registry) Requests() int64 {
+	return r.requests
+}
+
+// Sums returns the sums of all histograms.
+func (r *Registry) Sums() map[string]float64 {
+	res := make(map[string]float64)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, h := range r.histograms {
+		res[name] = h.sum
+	}
+	return res
+}
+
+// Reset clears all histograms.
+func (r *Registry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, h := range r.histograms {
+		h.mu.Lock()
+		clear(h.buckets)
+		h.sum = 0
+		h.mu.Unlock()
+	}
+}
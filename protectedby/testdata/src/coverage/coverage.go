@@ -0,0 +1,42 @@
+package coverage
+
+import "sync"
+
+type store struct {
+	// items is protected by mu.
+	items map[string]int
+	// hits is accessed atomically.
+	hits int64
+	// cond is associated with mu.
+	cond *sync.Cond
+	name string
+	mu   sync.Mutex
+}
+
+func (s *store) get(k string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.items[k]
+}
+
+func (s *store) set(k string, v int) {
+	s.mu.Lock()
+	s.items[k] = v
+	s.mu.Unlock()
+}
+
+type counter struct {
+	sync.Mutex
+	n     int
+	stats struct {
+		// total is read-only after init.
+		total int
+		mu    sync.Mutex
+	}
+}
+
+// plain has no lock and is not reported.
+type plain struct {
+	name string
+}
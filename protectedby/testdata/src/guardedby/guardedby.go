@@ -0,0 +1,25 @@
+package guardedby
+
+import "sync"
+
+type s struct {
+	// i is guarded by mu.
+	i int
+	// j is protected by mu.
+	j  int
+	mu sync.Mutex
+	// k is guarded by mu, protected by mu.// want `found 2 "protected by " or "guarded by " in comment "// k is guarded by mu, protected by mu.", expected exact one`
+	k int
+}
+
+func (s *s) unprotected() {
+	s.i++ // want `not protected access to shared field i, use s.mu.Lock()`
+	s.j++ // want `not protected access to shared field j, use s.mu.Lock()`
+}
+
+func (s *s) protected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.i++
+	s.j++
+}
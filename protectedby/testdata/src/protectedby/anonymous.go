@@ -0,0 +1,45 @@
+package protectedby
+
+import "sync"
+
+var state struct {
+	mu sync.Mutex
+	// n is protected by mu.
+	n int
+}
+
+type counters struct {
+	mu sync.Mutex
+
+	stats struct {
+		// hits is protected by mu of the enclosing struct.
+		hits int
+		// misses is protected by statsMu.
+		misses  int
+		statsMu sync.Mutex
+		// Errors is protected by mu.
+		Errors int // want `exported protected field counters.stats.Errors`
+		// lost is protected by unknownMu.// want `struct "counters.stats" does not have lock field "unknownMu"`
+		lost int
+	}
+}
+
+func anonymousVariable() {
+	state.mu.Lock()
+	state.n++
+	state.mu.Unlock()
+
+	state.n++ // want `not protected access to shared field n, lock state.mu released at line 30 before access`
+}
+
+func (c *counters) anonymousField() {
+	c.mu.Lock()
+	c.stats.hits++
+	c.stats.misses++ // want `not protected access to shared field misses, lock c.stats.statsMu acquired after access`
+	c.mu.Unlock()
+
+	c.stats.statsMu.Lock()
+	c.stats.misses++
+	c.stats.hits++ // want `not protected access to shared field hits, lock c.mu released at line 39 before access`
+	c.stats.statsMu.Unlock()
+}
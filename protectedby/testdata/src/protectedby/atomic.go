@@ -0,0 +1,48 @@
+package protectedby
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+type atomicCounters struct {
+	// hits is accessed atomically.
+	hits int64
+	// misses is accessed atomically. It has a sync/atomic type and must not be copied.
+	misses atomic.Int64
+	// ptr is accessed atomically.
+	ptr atomic.Pointer[int]
+	// Total is accessed atomically.
+	Total int64 // want `exported atomic field atomicCounters.Total`
+	// name is accessed atomically.
+	name string // want `field name of type string cannot be accessed atomically`
+	// counts is not accessed atomically, the phrase is negated.
+	counts []int
+	// Unlike hits, total is never accessed atomically.
+	total int64
+}
+
+func atomicAccess(c *atomicCounters) {
+	atomic.AddInt64(&c.hits, 1)
+	_ = atomic.LoadInt64(&(c.hits))
+	atomic.StoreInt64(&c.hits, 0)
+
+	c.misses.Add(1)
+	_ = c.misses.Load()
+	load := c.misses.Load
+	_ = load()
+	p := &c.misses
+	p.Store(0)
+
+	c.ptr.Store(nil)
+}
+
+func nonAtomicAccess(c *atomicCounters) {
+	c.hits++                          // want `non-atomic access to field hits, use sync/atomic functions with &c.hits`
+	fmt.Println(c.hits)               // want `non-atomic access to field hits, use sync/atomic functions with &c.hits`
+	p := &c.hits                      // want `non-atomic access to field hits, use sync/atomic functions with &c.hits`
+	atomic.AddInt64(p, 1)             // the pointer escapes the check, but it is reported above.
+	misses := c.misses                // want `non-atomic access to field misses, use c.misses methods instead of copying it`
+	c.misses = atomic.Int64{}         // want `non-atomic access to field misses, use c.misses methods instead of copying it`
+	fmt.Println(c.ptr, misses.Load()) // want `non-atomic access to field ptr, use c.ptr methods instead of copying it`
+}
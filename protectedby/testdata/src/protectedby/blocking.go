@@ -0,0 +1,69 @@
+package protectedby
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type poller struct {
+	// results is protected by mu.
+	results []string
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	conn    net.Conn
+	done    chan struct{}
+	queue   chan string
+}
+
+func newPoller(conn net.Conn) *poller {
+	return &poller{
+		conn:  conn,
+		done:  make(chan struct{}),
+		queue: make(chan string, 10),
+	}
+}
+
+func (p *poller) poll(url string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	resp, err := http.Get(url) // want `blocking call to net/http.Get while holding p.mu`
+	if err == nil {
+		p.results = append(p.results, resp.Status)
+	}
+	time.Sleep(time.Second) // want `blocking call to time.Sleep while holding p.mu`
+	p.wg.Wait()             // want `blocking call to \(\*sync.WaitGroup\).Wait while holding p.mu`
+	buf := make([]byte, 10)
+	_, _ = p.conn.Read(buf) // want `blocking call to \(net.Conn\).Read while holding p.mu`
+
+	p.done <- struct{}{} // want `blocking send to unbuffered channel p.done while holding p.mu`
+	<-p.done             // want `blocking receive from unbuffered channel p.done while holding p.mu`
+	p.queue <- url
+
+	select { // want `blocking select without default while holding p.mu`
+	case <-p.done:
+	case s := <-p.queue:
+		p.results = append(p.results, s)
+	}
+
+	select {
+	case <-p.done:
+	default:
+	}
+
+	go func() {
+		time.Sleep(time.Second)
+	}()
+}
+
+func (p *poller) pollUnlocked(url string) {
+	p.mu.Lock()
+	p.results = nil
+	p.mu.Unlock()
+
+	_, _ = http.Get(url)
+	time.Sleep(time.Second)
+	p.done <- struct{}{}
+}
@@ -0,0 +1,53 @@
+package protectedby
+
+type semaphoreStruct struct {
+	// i is protected by sem.
+	i int
+	// j is protected by recvOnly.
+	j        int
+	sem      chan struct{}
+	events   chan int
+	recvOnly <-chan struct{} // want `lock recvOnly doesn't implement sync.Locker interface`
+}
+
+func newSemaphoreStruct() *semaphoreStruct {
+	return &semaphoreStruct{sem: make(chan struct{}, 1)}
+}
+
+func (s *semaphoreStruct) protectedBySend() {
+	s.sem <- struct{}{}
+	defer func() { <-s.sem }()
+
+	s.i = 42
+}
+
+func (s *semaphoreStruct) notProtected() {
+	s.i = 42 // want `not protected access to shared field i, send to s.sem`
+}
+
+func (s *semaphoreStruct) releasedByReceive() {
+	s.sem <- struct{}{}
+	<-s.sem
+
+	s.i = 42 // want `not protected access to shared field i, lock s.sem released at line 30 before access`
+}
+
+func (s *semaphoreStruct) sendToAnotherChannel() {
+	s.events <- 42
+
+	s.i = 42 // want `not protected access to shared field i, send to s.sem`
+}
+
+type wideSemaphore struct {
+	// n is protected by sem.
+	n   int
+	sem chan struct{}
+}
+
+func newWideSemaphore(size int) *wideSemaphore {
+	s := &wideSemaphore{sem: make(chan struct{}, 2)} // want `lock sem is a channel with capacity 2, expected capacity one`
+	s.sem = make(chan struct{})                      // want `lock sem is a channel with capacity 0, expected capacity one`
+	s.sem = make(chan struct{}, size)
+	s.sem = make(chan struct{}, 1)
+	return s
+}
@@ -0,0 +1,70 @@
+package protectedby
+
+import "sync"
+
+type boundedQueue struct {
+	// items is protected by mu.
+	items []int
+	mu    sync.Mutex
+	// nonEmpty is associated with mu.
+	nonEmpty sync.Cond
+	notFull  *sync.Cond
+	limit    int
+}
+
+func newBoundedQueue(limit int) *boundedQueue {
+	q := &boundedQueue{limit: limit}
+	q.nonEmpty.L = &q.mu
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *boundedQueue) pop() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 {
+		q.nonEmpty.Wait()
+	}
+	i := q.items[0]
+	q.items = q.items[1:]
+	q.notFull.Signal()
+
+	return i
+}
+
+func (q *boundedQueue) push(i int) {
+	q.notFull.L.Lock()
+	defer q.notFull.L.Unlock()
+
+	for len(q.items) == q.limit {
+		q.notFull.Wait()
+	}
+	q.items = append(q.items, i)
+	q.nonEmpty.Signal()
+}
+
+func (q *boundedQueue) waitWithoutLock() {
+	q.nonEmpty.Wait() // want `not protected call to q.nonEmpty.Wait, use q.mu.Lock()`
+
+	q.mu.Lock()
+	q.mu.Unlock()
+	q.notFull.Wait() // want `not protected call to q.notFull.Wait, use q.mu.Lock()`
+}
+
+type invalidCond struct {
+	mu sync.Mutex
+	// c is associated with mu, but c is not a sync.Cond, so the comment is not an annotation.
+	c int
+	// cond is associated with missing.// want `struct "invalidCond" does not have lock field "missing"`
+	cond sync.Cond
+	n    int // want `lock n doesn't implement sync.Locker interface`
+	// other is associated with n.
+	other sync.Cond
+}
+
+type accountSession struct {
+	// user is the account associated with this session.
+	user string
+	mu   sync.Mutex
+}
@@ -0,0 +1,56 @@
+package protectedby
+
+type conn struct {
+	// buf is confined to (*conn).readLoop.
+	buf []byte
+	// pending is confined to conn.writeLoop.
+	pending int
+	// state is confined to missingLoop, which does not exist, so the comment is not an annotation.
+	state int
+	// deadline is confined to the range set by the server.
+	deadline int
+}
+
+func newConn() *conn {
+	c := &conn{}
+	c.buf = make([]byte, 0, 1024)
+
+	go c.readLoop()
+	go c.writeLoop()
+
+	return c
+}
+
+func (c *conn) readLoop() {
+	for {
+		c.buf = c.buf[:0]
+		c.fill()
+
+		func() {
+			c.buf = nil
+		}()
+
+		go func() {
+			c.buf = nil // want `access to field buf confined to \(\*conn\).readLoop from \(\*conn\).readLoop\$2`
+		}()
+	}
+}
+
+func (c *conn) fill() {
+	c.buf = append(c.buf, 42)
+}
+
+func (c *conn) writeLoop() {
+	c.pending++
+	c.flush()
+}
+
+func (c *conn) flush() {
+	c.pending = 0
+}
+
+func (c *conn) close() {
+	c.buf = nil // want `access to field buf confined to \(\*conn\).readLoop from \(\*conn\).close`
+	c.flush()
+	_ = c.state
+}
@@ -0,0 +1,59 @@
+package protectedby
+
+import "sync"
+
+type ledger struct {
+	// entries is protected by mu.
+	entries []string
+	// total is protected by mu.
+	total int
+	mu    *sync.Mutex
+	name  string
+}
+
+type book struct {
+	ledger ledger
+	pages  int
+}
+
+func newLedger() ledger {
+	l := ledger{mu: &sync.Mutex{}}
+	return l
+}
+
+func (l ledger) describe() string {
+	return l.name
+}
+
+func (l *ledger) add(e string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+}
+
+func printLedger(ledger) {}
+
+func copies(l *ledger, ledgers []ledger, b book) ledger {
+	c := *l    // want `copy of ledger by value, protected fields entries, total become unsynchronized copies`
+	var c2 = c // want `copy of ledger by value, protected fields entries, total become unsynchronized copies`
+	_ = c2
+
+	for _, v := range ledgers { // want `copy of ledger by value, protected fields entries, total become unsynchronized copies`
+		_ = v.name
+	}
+	for i := range ledgers {
+		ledgers[i].add("x")
+	}
+
+	printLedger(*l)              // want `copy of ledger by value, protected fields entries, total become unsynchronized copies`
+	ledgers = append(ledgers, c) // want `copy of ledger by value, protected fields entries, total become unsynchronized copies`
+	_ = l.describe()             // want `copy of ledger by value, protected fields entries, total become unsynchronized copies`
+	_ = b                        // blank assignments do not copy.
+	b2 := b                      // want `copy of book by value, protected fields ledger.entries, ledger.total become unsynchronized copies`
+	_ = b2.pages
+
+	printLedger(ledger{mu: l.mu})
+	printLedger(newLedger())
+
+	return *l // want `copy of ledger by value, protected fields entries, total become unsynchronized copies`
+}
@@ -13,5 +13,5 @@ func differentObjects() {
 	p2 := difObjStruct{}
 
 	p1.mu.Lock()
-	p2.i = 42 // want `not protected access to shared field i, use p2.mu.Lock()`
+	p2.i = 42 // want `not protected access to shared field i, a different instance's lock was taken \(p1.mu vs p2.mu\)`
 }
@@ -0,0 +1,117 @@
+package protectedby
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type escapeStruct struct {
+	// items is protected by mu.
+	items []int
+	// index is protected by mu.
+	index map[string]int
+	// n is protected by mu.
+	n  int
+	mu sync.Mutex
+}
+
+var leakedItems *[]int
+
+func (s *escapeStruct) referenceUsedAfterUnlock() {
+	s.mu.Lock()
+	p := &s.items // want `reference to protected field items escapes the critical section`
+	s.mu.Unlock()
+
+	*p = nil
+}
+
+func (s *escapeStruct) referenceUsedWithinCriticalSection() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := &s.n
+	*p = 42
+	s.items = append(s.items, *p)
+	s.index["n"] = len(s.items)
+	for _, i := range s.items {
+		s.n += i
+	}
+}
+
+func (s *escapeStruct) returnedHeader() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.items // want `reference to protected field items escapes the critical section`
+}
+
+func (s *escapeStruct) returnedAddress() *int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &s.n // want `reference to protected field n escapes the critical section`
+}
+
+func (s *escapeStruct) storedGlobally() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	leakedItems = &s.items // want `reference to protected field items escapes the critical section`
+}
+
+func (s *escapeStruct) passedToFunction() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Println(s.index) // want `reference to protected field index escapes the critical section`
+	fmt.Println(s.n)
+	sort.Ints(s.items) // want `reference to protected field items escapes the critical section`
+	sum(s.items)
+}
+
+func sum(items []int) int {
+	var res int
+	for _, i := range items {
+		res += i
+	}
+	return res
+}
+
+func (s *escapeStruct) passedToRetainingFunction() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	retain(s.items) // want `reference to protected field items escapes the critical section`
+}
+
+var retained []int
+
+func retain(items []int) {
+	retained = items
+}
+
+func (s *escapeStruct) passedToGoroutine() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	go sum(s.items) // want `reference to protected field items escapes the critical section`
+}
+
+func (s *escapeStruct) captured() func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.items // want `reference to protected field items escapes the critical section`
+	return func() {
+		items[0] = 42
+	}
+}
+
+func (s *escapeStruct) headerCopyUsedAfterUnlock() {
+	s.mu.Lock()
+	index := s.index // want `reference to protected field index escapes the critical section`
+	s.mu.Unlock()
+
+	index["n"] = 42
+}
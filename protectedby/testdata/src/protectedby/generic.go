@@ -0,0 +1,50 @@
+package protectedby
+
+import "sync"
+
+type safeMap[K comparable, V any] struct {
+	// m is protected by mu.
+	m  map[K]V
+	mu sync.Mutex
+}
+
+type stringIntMap = safeMap[string, int]
+
+type definedMap safeMap[int, int]
+
+func (s *safeMap[K, V]) get(k K) V {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.m[k]
+}
+
+func (s *safeMap[K, V]) unsafeGet(k K) V {
+	return s.m[k] // want `not protected access to shared field m, use s.mu.Lock()`
+}
+
+func useInstantiations() {
+	s := safeMap[string, bool]{}
+	s.m["a"] = true // want `not protected access to shared field m, use s.mu.Lock()`
+
+	var a stringIntMap
+	a.mu.Lock()
+	a.m["a"] = 42
+	a.mu.Unlock()
+	a.m["b"] = 42 // want `not protected access to shared field m, lock a.mu released at line 33 before access`
+
+	d := definedMap{}
+	d.m[1] = 42 // want `not protected access to shared field m, use d.mu.Lock()`
+}
+
+func useGenericParam[K comparable](s *safeMap[K, int], k K) {
+	s.m[k] = 42 // want `not protected access to shared field m, use s.mu.Lock()`
+}
+
+type embeddingSafeMap struct {
+	safeMap[int, string]
+}
+
+func usePromotedField(e *embeddingSafeMap) {
+	e.m[1] = "" // want `not protected access to shared field m, use e.mu.Lock()`
+}
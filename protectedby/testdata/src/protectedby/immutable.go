@@ -0,0 +1,81 @@
+package protectedby
+
+import "sync"
+
+type serverConfig struct {
+	addr string
+}
+
+type server struct {
+	cfg *serverConfig // immutable after newServer
+	// name is read-only after init.
+	name string
+	// limits is immutable.
+	limits [2]int
+	// conf is immutable.
+	conf serverConfig
+	// draft is not immutable, it is rewritten on reload.
+	draft serverConfig
+	// backup holds an immutableCopy of conf.
+	backup serverConfig
+
+	// conns is protected by mu.
+	conns int
+	mu    sync.Mutex
+}
+
+func newServer(cfg *serverConfig) *server {
+	s := newServerWithName("default")
+	s.cfg = cfg
+
+	return s
+}
+
+func newServerWithName(name string) *server {
+	s := &server{}
+	s.name = name
+	s.limits[0] = 42
+
+	return s
+}
+
+func newServerValue() server {
+	var s server
+	s.conf.addr = "localhost"
+
+	return s
+}
+
+func newServerWithNew() *server {
+	s := new(server)
+	s.name = "new"
+
+	return s
+}
+
+func (s *server) reads() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conns++
+	return s.cfg.addr + s.name + s.conf.addr
+}
+
+func (s *server) writes(cfg *serverConfig) {
+	s.cfg = cfg           // want `write to immutable field cfg outside of constructor newServer`
+	s.cfg.addr = "remote" // the pointed configuration is not the field itself.
+	s.name += "-copy"     // want `write to immutable field name outside of constructor`
+	s.limits[1] = 42      // want `write to immutable field limits outside of constructor`
+	s.conf.addr = ""      // want `write to immutable field conf outside of constructor`
+	p := &s.name          // want `write to immutable field name outside of constructor`
+	_ = p
+	for _, s.name = range []string{"a"} { // want `write to immutable field name outside of constructor`
+	}
+	s.draft = *cfg
+	s.backup = s.conf
+}
+
+func replaceServer(s *server) {
+	s2 := s
+	s2.name = "replaced" // want `write to immutable field name outside of constructor`
+}
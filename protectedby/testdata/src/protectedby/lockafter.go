@@ -10,6 +10,6 @@ type lockAfter struct {
 
 func lockAfterAccess() {
 	s := lockAfter{}
-	s.i = 42 // want `not protected access to shared field i, use s.mu.Lock()`
+	s.i = 42 // want `not protected access to shared field i, lock s.mu acquired after access`
 	s.mu.Lock()
 }
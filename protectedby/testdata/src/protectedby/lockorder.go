@@ -0,0 +1,122 @@
+package protectedby
+
+import "sync"
+
+type account struct {
+	// balance is protected by mu.
+	balance int
+	mu      sync.Mutex // mu acquired before stateMu.// want mu:"acquired before protectedby.account.stateMu"
+	// state is protected by stateMu.
+	state   string
+	stateMu sync.Mutex
+}
+
+func (a *account) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	a.balance = 0
+	a.state = "closed"
+}
+
+func (a *account) reopen() {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	a.mu.Lock() // want `lock account.mu acquired while holding account.stateMu, declared order is account.mu before account.stateMu`
+	defer a.mu.Unlock()
+
+	a.balance = 0
+	a.state = "open"
+}
+
+func (a *account) reset() {
+	a.stateMu.Lock()
+	a.state = ""
+	a.stateMu.Unlock()
+
+	a.mu.Lock()
+	a.balance = 0
+	a.mu.Unlock()
+}
+
+func (a *account) deposit(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.balance += n
+}
+
+func (a *account) refund() {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	a.deposit(1) // want `lock account.mu acquired in call to deposit while holding account.stateMu, declared order is account.mu before account.stateMu`
+	a.state = "refunded"
+}
+
+type pair struct {
+	// left is protected by leftMu.
+	left   int
+	leftMu sync.Mutex
+	// right is protected by rightMu.
+	right   int
+	rightMu sync.Mutex
+}
+
+func (p *pair) swapLeft() {
+	p.leftMu.Lock()
+	defer p.leftMu.Unlock()
+	p.rightMu.Lock() // want `potential deadlock: pair.rightMu acquired while holding pair.leftMu, lock order cycle pair.leftMu -> pair.rightMu -> pair.leftMu`
+	defer p.rightMu.Unlock()
+
+	p.left, p.right = p.right, p.left
+}
+
+func (p *pair) swapRight() {
+	p.rightMu.Lock()
+	defer p.rightMu.Unlock()
+	p.leftMu.Lock() // want `potential deadlock: pair.leftMu acquired while holding pair.rightMu, lock order cycle pair.rightMu -> pair.leftMu -> pair.rightMu`
+	defer p.leftMu.Unlock()
+
+	p.left, p.right = p.right, p.left
+}
+
+type invalidOrder struct {
+	mu sync.Mutex // mu acquired before missingMu.// want `struct "invalidOrder" does not have lock field "missingMu"`
+	m  sync.Mutex // m acquired before n.
+	// n acquired after mu, but n is not a lock, so the comment is not an annotation.
+	n int // want `lock n doesn't implement sync.Locker interface`
+}
+
+type session struct {
+	// token was acquired before the request started.
+	token string
+	mu    sync.Mutex
+}
+
+// Registry is used by other packages.
+type Registry struct {
+	// Mu is acquired before itemsMu.
+	Mu sync.Mutex // want Mu:"acquired before protectedby.Registry.Sub, protectedby.Registry.itemsMu"
+	// items is protected by itemsMu.
+	items   []string
+	itemsMu sync.Mutex // acquired after Mu.
+	// Sub is acquired after Mu.
+	Sub sync.Mutex
+}
+
+// Lookup acquires Mu.
+func (r *Registry) Lookup() { // want Lookup:"acquires protectedby.Registry.Mu"
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+}
+
+// Add acquires Mu and itemsMu.
+func (r *Registry) Add(item string) { // want Add:"acquires protectedby.Registry.Mu, protectedby.Registry.itemsMu"
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	r.itemsMu.Lock()
+	defer r.itemsMu.Unlock()
+
+	r.items = append(r.items, item)
+}
@@ -0,0 +1,40 @@
+package protectedby
+
+import "sync"
+
+// inventory has malformed annotations next to valid ones. The malformed annotations are reported and skipped, the
+// valid ones are checked.
+type inventory struct {
+	// items is protected by mu.
+	items map[string]int
+	// reserved is protected by mux.// want `struct "inventory" does not have lock field "mux"`
+	reserved map[string]int
+	// Total is protected by mu.
+	Total int // want `exported protected field inventory.Total`
+	// sold is protected by count.
+	sold  int
+	count int // want `lock count doesn't implement sync.Locker interface`
+	// returned is protected by mu, protected by mu.// want `found 2 "protected by " in comment "// returned is protected by mu, protected by mu.", expected exact one`
+	returned int
+	// mu is acquired before unknown.// want `struct "inventory" does not have lock field "unknown"`
+	mu sync.Mutex
+}
+
+func (i *inventory) add(name string) {
+	i.items[name]++ // want `not protected access to shared field items, use i.mu.Lock()`
+	i.reserved[name]++
+	i.Total++
+	i.sold++
+	i.returned++
+}
+
+func (i *inventory) addLocked(name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.items[name]++
+}
+
+// remove is called with i.missing held.// want `function remove requires unknown lock i.missing`
+func (i *inventory) remove(name string) {
+	delete(i.items, name) // want `not protected access to shared field items, use i.mu.Lock()`
+}
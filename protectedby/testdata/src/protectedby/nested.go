@@ -14,7 +14,9 @@ type outer struct {
 
 func nestedAccess() {
 	o := outer{}
-	// todo(mneverov): access to a protected field of a nested struct is not reported.
+	o.n.i = 42 // want `not protected access to shared field i, lock o.n.mu acquired after access`
+
+	o.n.mu.Lock()
 	o.n.i = 42
 }
 
@@ -22,7 +24,7 @@ func nestedFunction1() {
 	s := inner{}
 	f := func() {
 		// Just don't do this otherwise you get a false positive warning.
-		s.i = 42 // want `not protected access to shared field i, use s.mu.Lock()`
+		s.i = 42 // want `not protected access to shared field i, lock s.mu acquired after access`
 	}
 
 	s.mu.Lock()
@@ -0,0 +1,38 @@
+package plugins
+
+import "protectedby"
+
+type server struct {
+	// conns is protected by mu.
+	conns int
+	mu    chan struct{}
+}
+
+type callback struct {
+	s *server
+}
+
+// Handle implements Handler. The precondition is inherited from the imported interface.
+func (c *callback) Handle(s *protectedby.Server) { // want Handle:"called with arg0.Mu held"
+	c.s.conns++ // want `not protected access to shared field conns, send to c.s.mu`
+	s.Count()
+}
+
+func register(h protectedby.Handler, s *protectedby.Server) {
+	h.Handle(s) // want `not protected call to Handle, use s.Mu.Lock()`
+}
+
+var _ protectedby.Handler = &callback{}
+
+func lookupWithSub(r *protectedby.Registry) {
+	r.Sub.Lock()
+	defer r.Sub.Unlock()
+	r.Lookup() // want `lock protectedby.Registry.Mu acquired in call to Lookup while holding protectedby.Registry.Sub, declared order is protectedby.Registry.Mu before protectedby.Registry.Sub`
+}
+
+func lookupWithMu(r *protectedby.Registry) {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	r.Sub.Lock()
+	r.Sub.Unlock()
+}
@@ -0,0 +1,120 @@
+package protectedby
+
+import "sync"
+
+type dispatcher struct {
+	// events is protected by mu.
+	events  int
+	mu      sync.Mutex
+	plugins []Plugin
+}
+
+// Plugin is notified about dispatcher events.
+type Plugin interface {
+	// OnEvent is called with d.mu held.
+	OnEvent(d *dispatcher) // want OnEvent:"called with arg0.mu held"
+	// OnStop is called with d.unknown held.// want `function OnStop requires unknown lock d.unknown`
+	OnStop(d *dispatcher)
+}
+
+func (d *dispatcher) dispatch() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, p := range d.plugins {
+		p.OnEvent(d)
+	}
+	d.notify()
+}
+
+func (d *dispatcher) dispatchWithoutLock() {
+	for _, p := range d.plugins {
+		p.OnEvent(d) // want `not protected call to OnEvent, use d.mu.Lock()`
+	}
+	d.notify() // want `not protected call to notify, use d.mu.Lock()`
+}
+
+// notify must be called with mu held.
+func (d *dispatcher) notify() { // want notify:"called with recv.mu held"
+	d.events++
+	d.notifyAgain()
+}
+
+// notifyAgain is called with d.mu held.
+func (d *dispatcher) notifyAgain() { // want notifyAgain:"called with recv.mu held"
+	d.events++
+
+	d.mu.Unlock()
+	d.events++ // want `not protected access to shared field events, lock d.mu released at line 47 before access`
+	d.mu.Lock()
+}
+
+// count is called with mu held.// want `lock mu of function count is not a field of its parameters`
+func count() {}
+
+type countingPlugin struct{}
+
+// OnEvent inherits the precondition from Plugin.OnEvent.
+func (countingPlugin) OnEvent(disp *dispatcher) { // want OnEvent:"called with arg0.mu held"
+	disp.events++
+}
+
+func (countingPlugin) OnStop(d *dispatcher) {
+	d.events++ // want `not protected access to shared field events, use d.mu.Lock()`
+}
+
+// Server is used by handlers in other packages.
+type Server struct {
+	// count is protected by mu.
+	count int
+	mu    sync.Mutex
+	// Mu is exported for handlers. Not used to protect fields, hence not reported.
+	Mu sync.Mutex
+}
+
+// Handler handles server requests.
+type Handler interface {
+	// Handle is called with s.Mu held.
+	Handle(s *Server) // want Handle:"called with arg0.Mu held"
+}
+
+// Count is called with s.Mu held.
+func (s *Server) Count() {} // want Count:"called with recv.Mu held"
+
+// Listener is notified by its owner.
+type Listener interface {
+	// Notify is called with mu held.
+	Notify() // want Notify:"called with recv.mu held"
+}
+
+type recorder struct {
+	// seen is protected by mu.
+	seen int
+	mu   sync.Mutex
+}
+
+// Notify inherits the precondition from Listener.Notify.
+func (r *recorder) Notify() { // want Notify:"called with recv.mu held"
+	r.seen++
+}
+
+func (r *recorder) record() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Notify()
+}
+
+// notifyListener cannot hold the lock of the implementation, calls of interface methods that require a receiver
+// lock are not checked.
+func notifyListener(l Listener) {
+	l.Notify()
+}
+
+type writer struct{}
+
+// Flush can be called with a nil writer.
+func (w *writer) Flush() {}
+
+// Reset is called with the lock held.
+func (w *writer) Reset() {}
@@ -0,0 +1,73 @@
+package protectedby
+
+import "sync"
+
+type sharedLockA struct {
+	// x is protected by mu.
+	x  int
+	mu *sync.Mutex
+}
+
+type sharedLockB struct {
+	// y is protected by mu.
+	y  int
+	mu *sync.Mutex
+}
+
+type sharedLocker struct {
+	// z is protected by mu.
+	z  int
+	mu sync.Locker
+}
+
+func sharedPointerLock(b *sharedLockB) {
+	a := &sharedLockA{}
+	a.x = 42 // want `not protected access to shared field x, use a.mu.Lock()`
+
+	a.mu = b.mu
+	b.mu.Lock()
+	a.x = 42
+	b.y = 42
+	b.mu.Unlock()
+
+	a.x = 42 // want `not protected access to shared field x, lock b.mu released at line 31 before access`
+}
+
+func sharedLockInLiteral(b *sharedLockB) {
+	a := &sharedLockA{mu: b.mu}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	a.x = 42
+}
+
+func sharedLockViaVariable(a *sharedLockA) {
+	mu := a.mu
+	mu.Lock()
+	a.x = 42
+	mu.Unlock()
+
+	a.x = 42 // want `not protected access to shared field x, lock mu released at line 48 before access`
+}
+
+func sharedInterfaceLock(s1, s2 *sharedLocker) {
+	s2.mu = s1.mu
+	s1.mu.Lock()
+	defer s1.mu.Unlock()
+
+	s2.z = 42
+}
+
+func aliasAfterAccess(a *sharedLockA, b *sharedLockB) {
+	b.mu.Lock()
+	a.x = 42 // want `not protected access to shared field x, use a.mu.Lock()`
+	a.mu = b.mu
+	b.mu.Unlock()
+}
+
+func notAliasedLocks(a *sharedLockA, b *sharedLockB) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	a.x = 42 // want `not protected access to shared field x, use a.mu.Lock()`
+}
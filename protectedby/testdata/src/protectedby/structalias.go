@@ -0,0 +1,38 @@
+package protectedby
+
+import "sync"
+
+type structAlias struct {
+	// i is protected by mu.
+	i  int
+	mu sync.Mutex
+}
+
+func pointerAlias(s *structAlias) {
+	t := s
+	s.mu.Lock()
+	t.i = 1
+	s.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s.i = 2
+}
+
+func pointerAliasReassigned(s, other *structAlias) {
+	t := s
+	t = other
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t.i = 1 // want `not protected access to shared field i, a different instance's lock was taken \(s.mu vs t.mu\)`
+}
+
+func valueCopy() {
+	p1 := structAlias{}
+	p1.mu.Lock()
+	defer p1.mu.Unlock()
+
+	p2 := p1 // want `copy of structAlias by value, protected fields i become unsynchronized copies`
+	p2.i = 1 // want `not protected access to shared field i, a different instance's lock was taken \(p1.mu vs p2.mu\)`
+}
@@ -0,0 +1,98 @@
+package protectedby
+
+import "sync"
+
+type tryLocked struct {
+	// i is protected by mu.
+	i  int
+	mu sync.Mutex
+	// j is protected by rw.
+	j int
+	// k is protected by rw.
+	k  map[string]int
+	rw sync.RWMutex
+}
+
+func (t *tryLocked) earlyReturn() {
+	if !t.mu.TryLock() {
+		t.i++ // want `not protected access to shared field i, use t.mu.Lock()`
+		return
+	}
+	defer t.mu.Unlock()
+
+	t.i++
+}
+
+func (t *tryLocked) trueBranch() {
+	if t.mu.TryLock() {
+		t.i++
+		t.mu.Unlock()
+		t.i++ // want `not protected access to shared field i, use t.mu.Lock()`
+	}
+	t.i++ // want `not protected access to shared field i, use t.mu.Lock()`
+}
+
+func (t *tryLocked) elseBranch() {
+	if !(t.rw.TryRLock()) {
+		t.j++ // want `not protected access to shared field j, use t.rw.Lock()`
+	} else {
+		_ = t.j
+		t.rw.RUnlock()
+	}
+}
+
+func (t *tryLocked) notTerminating() {
+	if !t.mu.TryLock() {
+		t.mu.Lock()
+	}
+	t.i++
+
+	if !t.rw.TryLock() {
+		_ = t.i
+	}
+	t.j++ // want `not protected access to shared field j, use t.rw.Lock()`
+}
+
+func (t *tryLocked) spin() {
+	for !t.mu.TryLock() {
+		t.i++ // want `not protected access to shared field i, use t.mu.Lock()`
+	}
+	t.i++
+	t.mu.Unlock()
+}
+
+func (t *tryLocked) stored() {
+	ok := t.mu.TryLock()
+	if !ok {
+		return
+	}
+	t.i++ // want `not protected access to shared field i, use t.mu.Lock()`
+}
+
+func (t *tryLocked) readLocked() {
+	if t.rw.TryRLock() {
+		_ = t.j
+		t.j++   // want `not protected access to shared field j, use t.rw.Lock()`
+		t.j = 0 // want `not protected access to shared field j, use t.rw.Lock()`
+		_ = t.k["k"]
+		t.k["k"] = 1     // want `not protected access to shared field k, use t.rw.Lock()`
+		delete(t.k, "k") // want `not protected access to shared field k, use t.rw.Lock()`
+		t.rw.RUnlock()
+	}
+}
+
+func (t *tryLocked) readLockedByRLock() int {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+
+	t.j++ // want `not protected access to shared field j, lock t.rw held for reading only, use t.rw.Lock()`
+	return t.j
+}
+
+func (t *tryLocked) readAfterRUnlock() {
+	t.rw.RLock()
+	_ = t.k["k"]
+	t.rw.RUnlock()
+
+	_ = t.k["k"] // want `not protected access to shared field k, lock t.rw released at line 95 before access`
+}
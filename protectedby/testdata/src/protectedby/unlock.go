@@ -13,7 +13,7 @@ func unlockAfterLock(i *int) {
 	s.mu.Lock()
 	s.mu.Unlock()
 
-	s.i = i // want `not protected access to shared field i, use s.mu.Lock()`
+	s.i = i // want `not protected access to shared field i, lock s.mu released at line 14 before access`
 }
 
 func unlockBeforeLock(i *int) {
@@ -31,3 +31,14 @@ func deferUnlockIsFine(i *int) {
 
 	s.i = i
 }
+
+func lockInOtherBranch(i *int, locked bool) {
+	s := unlockStruct{}
+	if locked {
+		s.mu.Lock()
+		s.i = i
+		s.mu.Unlock()
+	} else {
+		s.i = i // want `not protected access to shared field i, lock s.mu acquired only in a different branch`
+	}
+}
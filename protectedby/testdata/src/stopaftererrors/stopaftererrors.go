@@ -0,0 +1,16 @@
+package stopaftererrors
+
+import "sync"
+
+type s struct {
+	// i is protected by missing.// want `struct "s" does not have lock field "missing"`
+	i  int
+	mu sync.Mutex
+	// j is protected by mu.
+	j int
+}
+
+// The package has a malformed annotation, so access to j is not checked.
+func (s *s) notChecked() {
+	s.j++
+}
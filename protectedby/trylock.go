@@ -0,0 +1,101 @@
+package protectedby
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// findTryLock returns the position of a TryLock() or TryRLock() call on the lock if the lock is acquired at the site,
+// i.e. the site is on the true edge of the condition the call controls:
+//
+//	if s.mu.TryLock() { <site> }
+//	if !s.mu.TryLock() { return }; <site>
+//	if !s.mu.TryLock() { ... } else { <site> }
+//	for !s.mu.TryLock() { ... }; <site>
+//
+// Returns token.NoPos if there is no such call. The result of TryLock stored in a variable is not tracked. TryRLock
+// only acquires the lock for sites that read the protected field, see site.readOnly.
+func findTryLock(s site, l lockRef) token.Pos {
+	res := token.NoPos
+	for _, op := range s.locks.tryLocksIdx.ops(l) {
+		// Same as for Lock(), a deferred statement can only use TryLock of the same statement.
+		if op.node.Pos() >= s.pos || !op.visibleFrom(s) || op.read && !s.readOnly {
+			continue
+		}
+
+		var held bool
+		switch stmt := op.node.(type) {
+		case *ast.IfStmt:
+			switch {
+			case !op.negated:
+				held = within(s.pos, stmt.Body)
+			case stmt.Else != nil:
+				held = within(s.pos, stmt.Else)
+			default:
+				held = isTerminating(stmt.Body) && isAfterInBlock(s, op)
+			}
+		case *ast.ForStmt:
+			held = op.negated && isAfterInBlock(s, op)
+		}
+		if held {
+			res = op.lock.Pos()
+		}
+	}
+
+	return res
+}
+
+// tryLockCall returns the lock of the TryLock() or TryRLock() call the condition consists of, whether the call
+// result is negated and whether the call is TryRLock.
+func tryLockCall(cond ast.Expr) (lock ast.Expr, negated, read bool) {
+	cond = ast.Unparen(cond)
+	if u, ok := cond.(*ast.UnaryExpr); ok && u.Op == token.NOT {
+		negated = true
+		cond = ast.Unparen(u.X)
+	}
+
+	call, ok := cond.(*ast.CallExpr)
+	if !ok {
+		return nil, false, false
+	}
+	if lock := lockMethodReceiver(call, "TryLock"); lock != nil {
+		return lock, negated, false
+	}
+	if lock := lockMethodReceiver(call, "TryRLock"); lock != nil {
+		return lock, negated, true
+	}
+
+	return nil, false, false
+}
+
+func within(pos token.Pos, n ast.Node) bool {
+	return n.Pos() <= pos && pos < n.End()
+}
+
+// isAfterInBlock reports whether the site follows the statement of the TryLock condition in the block that contains
+// the statement.
+func isAfterInBlock(s site, op *lockOp) bool {
+	return s.pos >= op.node.End() && op.block != nil && s.pos < op.block.End()
+}
+
+// isTerminating reports whether the block ends with a statement that leaves it: return, break, continue, goto or
+// panic.
+func isTerminating(b *ast.BlockStmt) bool {
+	if len(b.List) == 0 {
+		return false
+	}
+
+	switch stmt := b.List[len(b.List)-1].(type) {
+	case *ast.ReturnStmt, *ast.BranchStmt:
+		return true
+	case *ast.ExprStmt:
+		call, ok := stmt.X.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		id, ok := ast.Unparen(call.Fun).(*ast.Ident)
+		return ok && id.Name == "panic"
+	}
+
+	return false
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Report formats.
+const (
+	formatText = "text"
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+// packageReport is the annotation coverage of a package: the structs with a sync.Locker field and the suppressed
+// annotations.
+type packageReport struct {
+	Package    string          `json:"package"`
+	Structs    []*structReport `json:"structs"`
+	Suppressed []string        `json:"suppressed"`
+}
+
+type structReport struct {
+	Name string `json:"name"`
+	// Position is the position of the struct type relative to the working directory, e.g. "cache/cache.go:12".
+	Position  string         `json:"position"`
+	Locks     []string       `json:"locks"`
+	Annotated int            `json:"annotated"`
+	Fields    []*fieldReport `json:"fields"`
+}
+
+type fieldReport struct {
+	Name string `json:"name"`
+	// Annotation is empty if the field is not annotated.
+	Annotation string `json:"annotation"`
+	Suppressed bool   `json:"suppressed"`
+	Accesses   int    `json:"accesses"`
+}
+
+// newReport returns the coverage of the analyzed packages sorted by package path. Packages without structs with
+// a sync.Locker field and without suppressions are omitted.
+func newReport(res *result, root string) []*packageReport {
+	var reports []*packageReport
+	for path, c := range res.coverage {
+		if len(c.Structs) == 0 && len(c.Suppressed) == 0 {
+			continue
+		}
+		r := &packageReport{Package: path, Structs: []*structReport{}, Suppressed: c.Suppressed}
+		if r.Suppressed == nil {
+			r.Suppressed = []string{}
+		}
+		for _, s := range c.Structs {
+			sr := &structReport{
+				Name:      s.Name,
+				Position:  relativePosition(res.fset, root, s.Pos),
+				Locks:     s.Locks,
+				Annotated: s.Annotated(),
+				Fields:    []*fieldReport{},
+			}
+			for _, f := range s.Fields {
+				sr.Fields = append(sr.Fields, &fieldReport{
+					Name:       f.Name,
+					Annotation: f.Annotation,
+					Suppressed: f.Suppressed,
+					Accesses:   f.Accesses,
+				})
+			}
+			r.Structs = append(r.Structs, sr)
+		}
+		reports = append(reports, r)
+	}
+	slices.SortFunc(reports, func(a, b *packageReport) int {
+		return strings.Compare(a.Package, b.Package)
+	})
+
+	return reports
+}
+
+// relativePosition returns the file and line of the position, relative to root if the file is under root.
+func relativePosition(fset *token.FileSet, root string, pos token.Pos) string {
+	p := fset.Position(pos)
+	if rel, err := filepath.Rel(root, p.Filename); err == nil && !strings.HasPrefix(rel, "..") {
+		p.Filename = filepath.ToSlash(rel)
+	}
+
+	return fmt.Sprintf("%s:%d", p.Filename, p.Line)
+}
+
+func checkReportFormat(format string) error {
+	switch format {
+	case formatText, formatCSV, formatJSON:
+		return nil
+	}
+
+	return fmt.Errorf("unknown report format %q, expected %s, %s or %s", format, formatText, formatCSV, formatJSON)
+}
+
+// writeReport writes the reports in the given format.
+func writeReport(w io.Writer, format string, reports []*packageReport) error {
+	switch format {
+	case formatCSV:
+		return writeCSVReport(w, reports)
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+
+	return writeTextReport(w, reports)
+}
+
+func writeTextReport(w io.Writer, reports []*packageReport) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	var structs, fields, annotated int
+	for _, r := range reports {
+		fmt.Fprintln(tw, r.Package)
+		for _, s := range r.Structs {
+			fmt.Fprintf(tw, "  %s (%s) locked by %s: %d of %d fields annotated\n",
+				s.Name, s.Position, strings.Join(s.Locks, ", "), s.Annotated, len(s.Fields))
+			for _, f := range s.Fields {
+				switch {
+				case f.Annotation == "":
+					fmt.Fprintf(tw, "    %s\tnot annotated\n", f.Name)
+				case f.Suppressed:
+					fmt.Fprintf(tw, "    %s\t%s\tsuppressed\n", f.Name, f.Annotation)
+				default:
+					fmt.Fprintf(tw, "    %s\t%s\t%d accesses\n", f.Name, f.Annotation, f.Accesses)
+				}
+			}
+			structs++
+			fields += len(s.Fields)
+			annotated += s.Annotated
+		}
+		if len(r.Suppressed) > 0 {
+			fmt.Fprintf(tw, "  suppressed: %s\n", strings.Join(r.Suppressed, ", "))
+		}
+	}
+	fmt.Fprintf(tw, "total: %d of %d fields annotated in %d structs\n", annotated, fields, structs)
+
+	return tw.Flush()
+}
+
+func writeCSVReport(w io.Writer, reports []*packageReport) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"package", "struct", "position", "locks", "field", "annotation", "suppressed", "accesses"})
+	for _, r := range reports {
+		for _, s := range r.Structs {
+			for _, f := range s.Fields {
+				_ = cw.Write([]string{
+					r.Package,
+					s.Name,
+					s.Position,
+					strings.Join(s.Locks, " "),
+					f.Name,
+					f.Annotation,
+					strconv.FormatBool(f.Suppressed),
+					strconv.Itoa(f.Accesses),
+				})
+			}
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
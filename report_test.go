@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mneverov/protectedby/protectedby"
+)
+
+const reportSrc = `package rp
+
+import "sync"
+
+type cache struct {
+	// items is protected by mu.
+	items map[string]int
+	// hits is accessed atomically.
+	hits int64
+	name string
+	mu   sync.Mutex
+}
+
+func (c *cache) get(k string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.items[k]
+}
+
+type plain struct {
+	name string
+}
+`
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "go.mod", "module example.com/rp\n\ngo 1.22\n")
+	writeFile(t, "rp.go", reportSrc)
+
+	a := protectedby.NewAnalyzer(protectedby.Config{Suppress: []string{"example.com/rp.cache.hits"}})
+	res, err := analyze(a, false, []string{"./..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := newReport(res, dir)
+
+	var text bytes.Buffer
+	if err := writeReport(&text, formatText, reports); err != nil {
+		t.Fatal(err)
+	}
+	wantText := `example.com/rp
+  cache (rp.go:5) locked by mu: 2 of 3 fields annotated
+    items  protected by mu      1 accesses
+    hits   accessed atomically  suppressed
+    name   not annotated
+  suppressed: cache.hits
+total: 2 of 3 fields annotated in 1 structs
+`
+	if text.String() != wantText {
+		t.Errorf("unexpected text report:\n%s\nwant:\n%s", text.String(), wantText)
+	}
+
+	var csv bytes.Buffer
+	if err := writeReport(&csv, formatCSV, reports); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := `package,struct,position,locks,field,annotation,suppressed,accesses
+example.com/rp,cache,rp.go:5,mu,items,protected by mu,false,1
+example.com/rp,cache,rp.go:5,mu,hits,accessed atomically,true,0
+example.com/rp,cache,rp.go:5,mu,name,,false,0
+`
+	if csv.String() != wantCSV {
+		t.Errorf("unexpected csv report:\n%s\nwant:\n%s", csv.String(), wantCSV)
+	}
+
+	var js bytes.Buffer
+	if err := writeReport(&js, formatJSON, reports); err != nil {
+		t.Fatal(err)
+	}
+	var got []*packageReport
+	if err := json.Unmarshal(js.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].Structs) != 1 || got[0].Structs[0].Annotated != 2 ||
+		strings.Join(got[0].Suppressed, ",") != "cache.hits" {
+		t.Errorf("unexpected json report:\n%s", js.String())
+	}
+}
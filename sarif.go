@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mneverov/protectedby/protectedby"
+	"golang.org/x/tools/go/analysis"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	sarifSrcRoot = "%SRCROOT%"
+	toolURI      = "https://github.com/mneverov/protectedby"
+	// otherRule is the rule of diagnostics without a category.
+	otherRule = "protectedby"
+)
+
+// rules are the diagnostic categories of the analyzer in the order of SARIF rule indexes, followed by otherRule.
+var rules = append(protectedby.Categories(), protectedby.Category{
+	ID:    otherRule,
+	Short: "Other protectedby diagnostics.",
+	Help:  "See " + toolURI + " for the supported annotations.",
+})
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                      `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocURI `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                  `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	Help                 sarifMessage       `json:"help"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        int             `json:"ruleIndex"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLoc `json:"artifactLocation"`
+	Region           sarifRegion      `json:"region"`
+}
+
+type sarifArtifactLoc struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifArtifactLocURI struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// writeSARIF writes the diagnostics as a SARIF log. Paths under root are relative to %SRCROOT%. The levels of rules
+// and results are the levels of their categories.
+func writeSARIF(w io.Writer, root string, fset *token.FileSet, diags []diagnostic, sev protectedby.Severity) error {
+	ruleIndex := make(map[string]int, len(rules))
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "protectedby",
+				InformationURI: toolURI,
+			}},
+			OriginalURIBaseIDs: map[string]sarifArtifactLocURI{
+				sarifSrcRoot: {URI: "file://" + filepath.ToSlash(root) + "/"},
+			},
+			Results: []sarifResult{},
+		}},
+	}
+	run := &log.Runs[0]
+	for i, r := range rules {
+		ruleIndex[r.ID] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   r.ID,
+			ShortDescription:     sarifMessage{Text: r.Short},
+			Help:                 sarifMessage{Text: r.Help},
+			DefaultConfiguration: sarifConfiguration{Level: sev.Level(r.ID)},
+		})
+	}
+
+	for _, d := range diags {
+		id := d.Category
+		if _, ok := ruleIndex[id]; !ok {
+			id = otherRule
+		}
+		res := sarifResult{
+			RuleID:    id,
+			RuleIndex: ruleIndex[id],
+			Level:     sev.Level(id),
+			Message:   sarifMessage{Text: d.Message},
+			Locations: []sarifLocation{{PhysicalLocation: physicalLocation(root, fset, d.Pos, d.End)}},
+		}
+		for i, r := range d.Related {
+			res.RelatedLocations = append(res.RelatedLocations, relatedLocation(root, fset, i, r))
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(log)
+}
+
+func relatedLocation(root string, fset *token.FileSet, id int, r analysis.RelatedInformation) sarifLocation {
+	return sarifLocation{
+		ID:               &id,
+		Message:          &sarifMessage{Text: r.Message},
+		PhysicalLocation: physicalLocation(root, fset, r.Pos, r.End),
+	}
+}
+
+func physicalLocation(root string, fset *token.FileSet, pos, end token.Pos) sarifPhysicalLocation {
+	start := fset.Position(pos)
+	loc := sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLoc{URI: "file://" + filepath.ToSlash(start.Filename)},
+		Region:           sarifRegion{StartLine: start.Line, StartColumn: start.Column},
+	}
+	if rel, err := filepath.Rel(root, start.Filename); err == nil && !strings.HasPrefix(rel, "..") {
+		loc.ArtifactLocation = sarifArtifactLoc{URI: filepath.ToSlash(rel), URIBaseID: sarifSrcRoot}
+	}
+	if end.IsValid() {
+		e := fset.Position(end)
+		loc.Region.EndLine, loc.Region.EndColumn = e.Line, e.Column
+	}
+
+	return loc
+}
+
+// workingDir returns the working directory, the root of relative paths in SARIF output.
+func workingDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "/"
+	}
+
+	return wd
+}
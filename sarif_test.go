@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/mneverov/protectedby/protectedby"
+)
+
+const sarifSrc = `package sarif
+
+import "sync"
+
+type s struct {
+	// i is protected by mu.
+	i int
+	// j is protected by missing.
+	j  int
+	mu sync.Mutex
+}
+
+func (s *s) inc() {
+	s.i++
+}
+`
+
+func TestSARIF(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "go.mod", "module example.com/sarif\n\ngo 1.22\n")
+	writeFile(t, "sarif.go", sarifSrc)
+
+	res := analyzeModule(t)
+	var buf bytes.Buffer
+	sev := protectedby.Severity{"unknown-lock": protectedby.LevelWarning}
+	if err := writeSARIF(&buf, dir, res.fset, res.diagnostics, sev); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != sarifVersion || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log: version %q, %d runs", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(rules) {
+		t.Fatalf("expected %d rules, got %d", len(rules), len(run.Tool.Driver.Rules))
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(run.Results))
+	}
+
+	unknown, access := run.Results[0], run.Results[1]
+	if unknown.RuleID != "unknown-lock" || access.RuleID != "unprotected-access" {
+		t.Fatalf("unexpected rules %q, %q", unknown.RuleID, access.RuleID)
+	}
+	for _, r := range run.Results {
+		if got := run.Tool.Driver.Rules[r.RuleIndex].ID; got != r.RuleID {
+			t.Fatalf("rule index of %q points to %q", r.RuleID, got)
+		}
+		if got, rule := r.Level, run.Tool.Driver.Rules[r.RuleIndex]; got != rule.DefaultConfiguration.Level {
+			t.Fatalf("level of %q is %q, rule level is %q", r.RuleID, got, rule.DefaultConfiguration.Level)
+		}
+	}
+
+	if unknown.Level != "warning" || access.Level != "error" {
+		t.Fatalf("unexpected levels %q, %q", unknown.Level, access.Level)
+	}
+
+	loc := access.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "sarif.go" || loc.ArtifactLocation.URIBaseID != sarifSrcRoot {
+		t.Fatalf("unexpected artifact location %+v", loc.ArtifactLocation)
+	}
+	if loc.Region.StartLine != 14 {
+		t.Fatalf("expected result at line 14, got %d", loc.Region.StartLine)
+	}
+
+	// The annotation and the lock field.
+	if len(access.RelatedLocations) != 2 {
+		t.Fatalf("expected 2 related locations, got %d", len(access.RelatedLocations))
+	}
+	for i, line := range []int{6, 10} {
+		if got := access.RelatedLocations[i].PhysicalLocation.Region.StartLine; got != line {
+			t.Fatalf("expected related location %d at line %d, got %d", i, line, got)
+		}
+	}
+}